@@ -0,0 +1,187 @@
+package go_weave_api
+
+import (
+	"github.com/pkg/errors"
+	"net/netip"
+	"strings"
+)
+
+type addressKind int
+
+const (
+	addressDefaultSubnet addressKind = iota
+	addressSubnet
+	addressStaticIP
+	addressApplication
+)
+
+// AddressSpec is an address requested for a container or the host: an
+// allocation from the default subnet, an allocation from a subnet or a
+// static ip, or an allocation from the subnet the SubnetPlanner assigned
+// to an application. The cidr of a spec is validated when it is used, so an invalid
+// spec makes Attach fail instead of falling back to the default subnet.
+type AddressSpec struct {
+	kind addressKind
+	cidr string
+	name string
+}
+
+// DefaultSubnet allocates an address from the default subnet of ipam.
+func DefaultSubnet() AddressSpec {
+	return AddressSpec{kind: addressDefaultSubnet}
+}
+
+// Subnet allocates an address from the subnet cidr, e.g. 10.32.1.0/24.
+func Subnet(cidr string) AddressSpec {
+	return AddressSpec{kind: addressSubnet, cidr: cidr}
+}
+
+// StaticIP claims the address of cidr, e.g. 10.32.1.5/24.
+func StaticIP(cidr string) AddressSpec {
+	return AddressSpec{kind: addressStaticIP, cidr: cidr}
+}
+
+// Application allocates an address from the subnet of the application, the
+// subnet is assigned by the SubnetPlanner of the Weave node.
+func Application(name string) AddressSpec {
+	return AddressSpec{kind: addressApplication, name: name}
+}
+
+// ParseAddressSpec parses the address arguments of the weave script:
+// net:default, net:<cidr>, ip:<cidr> or a plain <cidr> for a static ip, and
+// app:<name> for an application subnet.
+func ParseAddressSpec(s string) (AddressSpec, error) {
+	var spec AddressSpec
+	switch {
+	case s == "net:default":
+		return DefaultSubnet(), nil
+	case strings.HasPrefix(s, "app:"):
+		if s == "app:" {
+			return AddressSpec{}, errors.New("empty application name")
+		}
+		return Application(strings.TrimPrefix(s, "app:")), nil
+	case strings.HasPrefix(s, "net:"):
+		spec = Subnet(strings.TrimPrefix(s, "net:"))
+	case strings.HasPrefix(s, "ip:"):
+		spec = StaticIP(strings.TrimPrefix(s, "ip:"))
+	default:
+		spec = StaticIP(s)
+	}
+	if _, err := spec.Prefix(); err != nil {
+		return AddressSpec{}, err
+	}
+	return spec, nil
+}
+
+// ParseAddressSpecs parses every arg with ParseAddressSpec.
+func ParseAddressSpecs(args ...string) ([]AddressSpec, error) {
+	specs := make([]AddressSpec, 0, len(args))
+	for _, arg := range args {
+		spec, err := ParseAddressSpec(arg)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func (a AddressSpec) IsDefaultSubnet() bool {
+	return a.kind == addressDefaultSubnet
+}
+
+func (a AddressSpec) IsSubnet() bool {
+	return a.kind == addressSubnet
+}
+
+func (a AddressSpec) IsStaticIP() bool {
+	return a.kind == addressStaticIP
+}
+
+func (a AddressSpec) IsApplication() bool {
+	return a.kind == addressApplication
+}
+
+// Application returns the application name of an Application spec.
+func (a AddressSpec) Application() string {
+	return a.name
+}
+
+// Prefix validates the cidr of a subnet or a static ip, a subnet must not
+// have host bits set. DefaultSubnet and Application have no prefix.
+func (a AddressSpec) Prefix() (netip.Prefix, error) {
+	switch a.kind {
+	case addressSubnet:
+		prefix, err := netip.ParsePrefix(a.cidr)
+		if err != nil || !prefix.Addr().Is4() {
+			return netip.Prefix{}, errors.Errorf("invalid subnet %q, expected an ipv4 cidr", a.cidr)
+		}
+		if prefix.Masked() != prefix {
+			return netip.Prefix{}, errors.Errorf("subnet %s has host bits set, expected %s", a.cidr, prefix.Masked())
+		}
+		return prefix, nil
+	case addressStaticIP:
+		prefix, err := netip.ParsePrefix(a.cidr)
+		if err != nil || !prefix.Addr().Is4() {
+			return netip.Prefix{}, errors.Errorf("invalid ip %q, expected an ipv4 cidr", a.cidr)
+		}
+		return prefix, nil
+	case addressApplication:
+		return netip.Prefix{}, errors.Errorf("application %s has no prefix before it is planned", a.name)
+	}
+	return netip.Prefix{}, errors.New("the default subnet has no prefix")
+}
+
+// String returns the weave script form of a, which ParseAddressSpec accepts.
+func (a AddressSpec) String() string {
+	switch a.kind {
+	case addressSubnet:
+		return "net:" + a.cidr
+	case addressStaticIP:
+		return "ip:" + a.cidr
+	case addressApplication:
+		return "app:" + a.name
+	}
+	return "net:default"
+}
+
+// AttachOptions are the options of Attach, the zero value attaches the
+// container to the default subnet and registers its name in weaveDNS.
+type AttachOptions struct {
+	WithoutDNS bool
+	// RewriteHosts rewrites /etc/hosts of the container with its weave addresses
+	RewriteHosts bool
+	// NoMulticastRoute skips the multicast route on the weave interface
+	NoMulticastRoute bool
+	// Hosts are extra /etc/hosts entries in the form name:ip, used with RewriteHosts
+	Hosts []string
+	// Addresses defaults to DefaultSubnet when empty
+	Addresses []AddressSpec
+}
+
+// AddressResult lists the addresses actually assigned to or removed from a
+// container, or the host for Expose and Hide.
+type AddressResult struct {
+	ContainerId string
+	// Addresses are all the addresses, in the order of the specs
+	Addresses []netip.Prefix
+	// Allocated are the addresses ipam allocated from a subnet, a subset of Addresses
+	Allocated []netip.Prefix
+}
+
+// IPs returns the addresses without their prefix length.
+func (r *AddressResult) IPs() []netip.Addr {
+	ips := make([]netip.Addr, 0, len(r.Addresses))
+	for _, prefix := range r.Addresses {
+		ips = append(ips, prefix.Addr())
+	}
+	return ips
+}
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	s := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		s = append(s, prefix.String())
+	}
+	return s
+}
@@ -0,0 +1,97 @@
+package go_weave_api
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/netip"
+	"sync"
+	"testing"
+)
+
+func TestParseAddressSpec(t *testing.T) {
+	spec, err := ParseAddressSpec("net:default")
+	require.NoError(t, err)
+	require.True(t, spec.IsDefaultSubnet())
+
+	spec, err = ParseAddressSpec("net:10.32.1.0/24")
+	require.NoError(t, err)
+	require.True(t, spec.IsSubnet())
+	require.Equal(t, "net:10.32.1.0/24", spec.String())
+
+	spec, err = ParseAddressSpec("ip:10.32.1.5/24")
+	require.NoError(t, err)
+	require.True(t, spec.IsStaticIP())
+	prefix, err := spec.Prefix()
+	require.NoError(t, err)
+	require.Equal(t, netip.MustParsePrefix("10.32.1.5/24"), prefix)
+
+	spec, err = ParseAddressSpec("10.32.1.5/24")
+	require.NoError(t, err)
+	require.Equal(t, StaticIP("10.32.1.5/24"), spec)
+
+	spec, err = ParseAddressSpec("app:web")
+	require.NoError(t, err)
+	require.Equal(t, Application("web"), spec)
+
+	for _, invalid := range []string{"app:", "net:10.32.1.0", "net:10.32.1.5/24", "ip:10.32.1.300/24", "10.32.1.5", "net:defualt", "fd00::1/64"} {
+		_, err := ParseAddressSpec(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestWeave_ipamCIDRs(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ip/90440c9f28af", func(rw http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodGet, r.Method)
+		fmt.Fprint(rw, "10.32.0.1/12 10.44.0.3/24\n")
+	})
+	mux.HandleFunc("/ip/90440c9f28af/10.44.0.0/24", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "10.44.0.3/24")
+	})
+	w := newFakeRouter(t, mux)
+
+	allocated, all, err := w.ipamCIDRs("lookup", "90440c9f28af", nil)
+	require.NoError(t, err)
+	require.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.32.0.1/12"), netip.MustParsePrefix("10.44.0.3/24")}, allocated)
+	require.Equal(t, allocated, all)
+
+	allocated, all, err = w.ipamCIDRs("lookup", "90440c9f28af", []AddressSpec{Subnet("10.44.0.0/24"), StaticIP("10.50.0.1/16")})
+	require.NoError(t, err)
+	require.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.44.0.3/24")}, allocated)
+	require.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.44.0.3/24"), netip.MustParsePrefix("10.50.0.1/16")}, all)
+
+	// a typo must not fall back to the default subnet
+	_, _, err = w.ipamCIDRs("lookup", "90440c9f28af", []AddressSpec{Subnet("10.44.0/24")})
+	require.Error(t, err)
+}
+
+func TestWeave_ExposeDefaultSubnet(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/ipinfo/tracker":
+			fmt.Fprint(rw, "ring")
+		case "/ip/weave:expose":
+			fmt.Fprint(rw, "10.32.0.2/12")
+		}
+	})
+	w := newFakeRouter(t, mux)
+	w.dns.weave = w
+
+	result, err := w.Expose("host1", true, DefaultSubnet())
+	require.NoError(t, err)
+	require.Equal(t, "weave:expose", result.ContainerId)
+	require.Equal(t, []netip.Addr{netip.MustParseAddr("10.32.0.2")}, result.IPs())
+	require.Equal(t, []string{
+		"GET /ipinfo/tracker",
+		"POST /ip/weave:expose",
+		"POST /expose/10.32.0.2/12",
+		"PUT /name/weave:expose/10.32.0.2",
+	}, calls)
+}
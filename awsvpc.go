@@ -0,0 +1,74 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	ipamTrackerRing   = "ring"
+	ipamTrackerAWSVPC = "awsvpc"
+)
+
+// ipamTracker returns the ipam tracker of the router, ring or awsvpc. The
+// tracker can not change without relaunching the router, so it is cached.
+func (w *Weave) ipamTracker(ctx context.Context) (string, error) {
+	w.trackerMu.Lock()
+	defer w.trackerMu.Unlock()
+	if w.tracker != "" {
+		return w.tracker, nil
+	}
+	result, err := callWeaveContext(ctx, http.MethodGet, fmt.Sprintf("http://%s:%d/ipinfo/tracker",
+		w.address, w.httpPort), nil)
+	if err != nil {
+		return "", err
+	}
+	w.tracker = strings.TrimSpace(string(result))
+	return w.tracker, nil
+}
+
+// resetTracker drops the cached tracker, a relaunched router may use another
+// one.
+func (w *Weave) resetTracker() {
+	w.trackerMu.Lock()
+	w.tracker = ""
+	w.trackerMu.Unlock()
+}
+
+// isAWSVPC reports whether the router tracks the addresses in the AWS VPC
+// route table.
+func (w *Weave) isAWSVPC(ctx context.Context) (bool, error) {
+	tracker, err := w.ipamTracker(ctx)
+	if err != nil {
+		return false, err
+	}
+	return tracker == ipamTrackerAWSVPC, nil
+}
+
+// validateAWSVPCAddresses rejects explicit addresses in AWSVPC mode, the
+// route table only knows the addresses of the default subnet.
+func validateAWSVPCAddresses(specs []AddressSpec) error {
+	for _, spec := range specs {
+		if !spec.IsDefaultSubnet() {
+			return errors.Errorf("no IP addresses or subnets may be specified in AWSVPC mode, got %s", spec)
+		}
+	}
+	return nil
+}
+
+// validateAWSVPC checks the launch options of AWSVPC mode.
+func (w *Weave) validateAWSVPC() error {
+	if !w.awsvpc {
+		return nil
+	}
+	if w.ipAllocDefaultSubnet != "" && w.ipAllocDefaultSubnet != w.ipRange {
+		return errors.Errorf("the default subnet %s must be the ip range %s in AWSVPC mode", w.ipAllocDefaultSubnet, w.ipRange)
+	}
+	if w.noDefaultIpAlloc {
+		return errors.New("AWSVPC mode needs the default ip allocation")
+	}
+	return nil
+}
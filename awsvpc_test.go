@@ -0,0 +1,79 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func newFakeTrackerRouter(t *testing.T, tracker string, trackerCalls *int32) *Weave {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ipinfo/tracker", func(rw http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(trackerCalls, 1)
+		fmt.Fprint(rw, tracker)
+	})
+	mux.HandleFunc("/ip/weave:expose", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "10.32.0.2/12")
+	})
+	mux.HandleFunc("/ip/weave:expose/10.44.0.0/24", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "10.44.0.1/24")
+	})
+	mux.HandleFunc("/expose/", func(rw http.ResponseWriter, r *http.Request) {})
+	return newFakeRouter(t, mux)
+}
+
+func TestWeave_AWSVPCMode(t *testing.T) {
+	var calls int32
+	w := newFakeTrackerRouter(t, "awsvpc", &calls)
+
+	awsvpc, err := w.isAWSVPC(context.Background())
+	require.NoError(t, err)
+	require.True(t, awsvpc)
+
+	_, err = w.Expose("", false, Subnet("10.44.0.0/24"))
+	require.Error(t, err)
+	_, _, err = w.ipamCIDRs("allocate", "90440c9f28af", []AddressSpec{StaticIP("10.32.0.9/12")})
+	require.Error(t, err)
+
+	result, err := w.Expose("", false)
+	require.NoError(t, err)
+	require.Equal(t, "10.32.0.2/12", result.Addresses[0].String())
+	// the tracker is detected once
+	require.Equal(t, int32(1), calls)
+
+	// until the router is relaunched
+	w.resetTracker()
+	_, err = w.isAWSVPC(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int32(2), calls)
+}
+
+func TestWeave_RingMode(t *testing.T) {
+	var calls int32
+	w := newFakeTrackerRouter(t, "ring", &calls)
+
+	awsvpc, err := w.isAWSVPC(context.Background())
+	require.NoError(t, err)
+	require.False(t, awsvpc)
+
+	result, err := w.Expose("", false, Subnet("10.44.0.0/24"))
+	require.NoError(t, err)
+	require.Equal(t, "10.44.0.1/24", result.Addresses[0].String())
+}
+
+func TestWeave_validateAWSVPC(t *testing.T) {
+	w := &Weave{ipRange: "10.32.0.0/12"}
+	WithAWSVPC()(w)
+	require.NoError(t, w.validateAWSVPC())
+
+	WithIpAllocDefaultSubnet("10.32.0.0/16")(w)
+	require.Error(t, w.validateAWSVPC())
+
+	w = &Weave{ipRange: "10.32.0.0/12"}
+	WithAWSVPC()(w)
+	NoDefaultIPAlloc()(w)
+	require.Error(t, w.validateAWSVPC())
+}
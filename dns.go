@@ -2,42 +2,211 @@ package go_weave_api
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"fmt"
+	"github.com/docker/docker/api/types/container"
 	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+	"io"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// DNSSourceSystem is the source of the answers from the resolver of this host
+const DNSSourceSystem = "system"
+
+const dnsQueryTimeout = 5 * time.Second
+
+var errDNSDisabled = errors.New("weaveDNS disabled")
+
+type DNSLookupMode int
+
+const (
+	// DNSLookupWeaveOnly only asks weaveDNS
+	DNSLookupWeaveOnly DNSLookupMode = iota
+	// DNSLookupWithFallback asks the resolver of this host when weaveDNS has no answer
+	DNSLookupWithFallback
+)
+
+// DNSArgs are the dns settings which let a container resolve weave names,
+// like the output of `weave dns-args`.
+type DNSArgs struct {
+	Servers []string
+	Search  []string
+	Options []string
+}
+
+// ApplyHostConfig puts the weaveDNS settings in front of the dns settings of hostConfig.
+func (a *DNSArgs) ApplyHostConfig(hostConfig *container.HostConfig) {
+	hostConfig.DNS = mergeDNSValues(a.Servers, hostConfig.DNS)
+	hostConfig.DNSSearch = mergeDNSValues(a.Search, hostConfig.DNSSearch)
+	hostConfig.DNSOptions = mergeDNSValues(a.Options, hostConfig.DNSOptions)
+}
+
+// DockerArgs returns the settings as arguments of `docker run`.
+func (a *DNSArgs) DockerArgs() []string {
+	var args []string
+	for _, server := range a.Servers {
+		args = append(args, "--dns="+server)
+	}
+	for _, search := range a.Search {
+		args = append(args, "--dns-search="+search)
+	}
+	for _, option := range a.Options {
+		args = append(args, "--dns-option="+option)
+	}
+	return args
+}
+
+func mergeDNSValues(first, second []string) []string {
+	var merged []string
+	seen := make(map[string]struct{})
+	for _, values := range [][]string{first, second} {
+		for _, value := range values {
+			if _, ok := seen[value]; ok {
+				continue
+			}
+			seen[value] = struct{}{}
+			merged = append(merged, value)
+		}
+	}
+	return merged
+}
+
+// DNSAnswer is an A record returned by a lookup.
+type DNSAnswer struct {
+	Name string
+	IP   net.IP
+	// TTL is zero for the answers of the resolver of this host
+	TTL time.Duration
+	// Source is the address of the weaveDNS server which answered, or DNSSourceSystem
+	Source string
+}
+
 type DNSServer struct {
-	weave    *Weave
-	Address  string
+	weave   *Weave
+	Address string
+	// Search is the weaveDNS domain, it is passed to the router as --dns-domain
 	Search   string
 	Disabled bool
+	// TTL is the ttl in seconds of the answers of weaveDNS, 0 keeps the router default
+	TTL int
+	// Fallback are the resolvers weaveDNS forwards the names outside its domain
+	// to, instead of the resolv.conf of the host. The router reads them from a
+	// resolv.conf, so Launch rejects a port other than 53.
+	Fallback []string
+	// EffectiveAddress is the address weaveDNS is reachable at when it differs
+	// from Address, e.g. after a port mapping
+	EffectiveAddress string
 }
 
 func NewDNSServer(address, search string, disabled bool) *DNSServer {
-	return &DNSServer{nil, address, search, disabled}
+	return &DNSServer{Address: address, Search: search, Disabled: disabled}
+}
+
+// fallbackServers returns the fallback resolvers with the dns port
+func (dns *DNSServer) fallbackServers() []string {
+	servers := make([]string, 0, len(dns.Fallback))
+	for _, server := range dns.Fallback {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		servers = append(servers, server)
+	}
+	return servers
 }
 
-func (dns *DNSServer) getDNSArgs() (map[string]string, error) {
+// validateFallback checks the fallback resolvers of the router. A resolv.conf
+// has no ports, so the router would ask another port than LookupDNSRecords.
+func (dns *DNSServer) validateFallback() error {
+	for _, server := range dns.Fallback {
+		host, port, err := net.SplitHostPort(server)
+		if err != nil {
+			host, port = server, "53"
+		}
+		if net.ParseIP(host) == nil {
+			return errors.Errorf("invalid dns fallback resolver %s", server)
+		}
+		if port != "53" {
+			return errors.Errorf("dns fallback resolver %s has port %s, the router only uses port 53", server, port)
+		}
+	}
+	return nil
+}
+
+// launchArgs returns the router arguments of weaveDNS
+func (dns *DNSServer) launchArgs() []string {
 	if dns.Disabled {
-		return nil, errors.New("dns server disabled")
+		return []string{"--no-dns"}
+	}
+	args := []string{"--dns-domain", strings.TrimSuffix(dns.Search, ".") + "."}
+	if dns.TTL > 0 {
+		args = append(args, "--dns-ttl", strconv.Itoa(dns.TTL))
+	}
+	if dns.EffectiveAddress != "" {
+		args = append(args, "--dns-effective-listen-address", dns.EffectiveAddress)
+	}
+	return args
+}
+
+// dnsArgs returns the dns settings of the containers which use weaveDNS
+func (dns *DNSServer) dnsArgs() (*DNSArgs, error) {
+	if dns.Disabled {
+		return nil, errDNSDisabled
+	}
+	address := dns.Address
+	if dns.EffectiveAddress != "" {
+		address = dns.EffectiveAddress
 	}
-	return map[string]string{
-		"address": dns.Address,
-		"search":  dns.Search,
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, "53"
+	}
+	if net.ParseIP(host) == nil {
+		return nil, errors.Errorf("weaveDNS address %s is not an ip address", address)
+	}
+	// docker only lets containers use name servers on the default port
+	if port != "53" {
+		return nil, errors.Errorf("weaveDNS listens on port %s, containers can only use port 53", port)
+	}
+	return &DNSArgs{
+		Servers: []string{host},
+		Search:  []string{strings.TrimSuffix(dns.Search, ".") + "."},
 	}, nil
 }
 
-func (dns *DNSServer) getDNSArgsRemote() (map[string]string, error) {
-	return nil, nil
+// domain returns the weaveDNS domain as a dns name
+func (dns *DNSServer) domain() (DNSName, error) {
+	domain, err := ParseDNSName(dns.Search)
+	if err != nil {
+		return domain, errors.Wrap(err, "invalid weaveDNS domain")
+	}
+	return domain, nil
+}
+
+// fqdn validates name and qualifies it with the weaveDNS domain
+func (dns *DNSServer) fqdn(name string) (string, error) {
+	domain, err := dns.domain()
+	if err != nil {
+		return "", err
+	}
+	n, err := ParseDNSName(name)
+	if err != nil {
+		return "", err
+	}
+	return n.Qualify(domain).String(), nil
 }
 
 func (dns *DNSServer) addWeaveDNS(containerId, cip, fqdn string, external bool) error {
-	if !strings.Contains(fqdn, dns.Search) {
-		fqdn = fmt.Sprintf("%s.%s", fqdn, dns.Search)
+	fqdn, err := dns.fqdn(fqdn)
+	if err != nil {
+		return err
 	}
 
 	checkAlive := true
@@ -55,7 +224,7 @@ func (dns *DNSServer) addWeaveDNS(containerId, cip, fqdn string, external bool)
 
 	address := fmt.Sprintf("%s:%d", dns.weave.address, dns.weave.httpPort)
 	dnsUrl := fmt.Sprintf("http://%s/name/%s/%s", address, containerId, cip)
-	_, err := callWeave(http.MethodPut, dnsUrl, bytes.NewReader([]byte(values.Encode())))
+	_, err = callWeave(http.MethodPut, dnsUrl, bytes.NewReader([]byte(values.Encode())))
 	if err != nil {
 		return err
 	}
@@ -63,18 +232,31 @@ func (dns *DNSServer) addWeaveDNS(containerId, cip, fqdn string, external bool)
 	return nil
 }
 
+// removeWeaveDNS removes the name of a container, all its names when fqdn is
+// empty and the names of all its addresses when ip is empty.
 func (dns *DNSServer) removeWeaveDNS(containerId, ip, fqdn string, external bool) error {
-	if fqdn != "" && !strings.Contains(fqdn, dns.Search) {
-		fqdn = fmt.Sprintf("?fqdn=%s.%s", fqdn, dns.Search)
+	var query string
+	if fqdn != "" {
+		qualified, err := dns.fqdn(fqdn)
+		if err != nil {
+			return err
+		}
+		query = "?" + url.Values{"fqdn": []string{qualified}}.Encode()
 	}
 	if external {
-		containerId = "weave:extern"
+		if containerId != "weave:extern" && containerId != "weave:expose" {
+			containerId = "weave:extern"
+		}
 		if fqdn == "" {
 			return errors.New("fqdn is required when removing external dns")
 		}
 	}
 	address := fmt.Sprintf("%s:%d", dns.weave.address, dns.weave.httpPort)
-	dnsUrl := fmt.Sprintf("http://%s/name/%s/%s%s", address, containerId, ip, fqdn)
+	dnsUrl := fmt.Sprintf("http://%s/name/%s", address, containerId)
+	if ip != "" {
+		dnsUrl += "/" + ip
+	}
+	dnsUrl += query
 
 	_, err := callWeave(http.MethodDelete, dnsUrl, nil)
 	if err != nil {
@@ -83,5 +265,136 @@ func (dns *DNSServer) removeWeaveDNS(containerId, ip, fqdn string, external bool
 	return nil
 }
 
-// Deprecated
-func (dns *DNSServer) lookupWeaveDNS() {}
+// qualify makes a name absolute for a lookup, like a resolver with ndots:1 a
+// relative name without dots is qualified with the weaveDNS domain.
+func (dns *DNSServer) qualify(name string) (string, error) {
+	n, err := ParseDNSName(name)
+	if err != nil {
+		return "", err
+	}
+	if !n.IsAbsolute() && len(n.labels) == 1 {
+		domain, err := dns.domain()
+		if err != nil {
+			return "", err
+		}
+		return n.Qualify(domain).String(), nil
+	}
+	n.absolute = true
+	return n.String(), nil
+}
+
+// relative trims the weaveDNS domain from name
+func (dns *DNSServer) relative(name string) string {
+	n, err := ParseDNSName(name)
+	if err != nil {
+		return strings.TrimSuffix(name, ".")
+	}
+	domain, err := dns.domain()
+	if err != nil {
+		return strings.TrimSuffix(name, ".")
+	}
+	return n.Relative(domain).String()
+}
+
+// queryA sends an A query for the absolute fqdn to server, the query is sent
+// again over tcp when the udp answer is truncated.
+func queryA(ctx context.Context, server, fqdn string) ([]DNSAnswer, error) {
+	name, err := dnsmessage.NewName(fqdn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid dns name %s", fqdn)
+	}
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: uint16(rand.Uint32()), RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+		},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := exchangeDNS(ctx, server, "udp", packed)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Header.Truncated {
+		if resp, err = exchangeDNS(ctx, server, "tcp", packed); err != nil {
+			return nil, err
+		}
+	}
+	if resp.Header.ID != query.Header.ID {
+		return nil, errors.New("dns answer does not match the query")
+	}
+	if resp.Header.RCode == dnsmessage.RCodeNameError {
+		return nil, nil
+	}
+	if resp.Header.RCode != dnsmessage.RCodeSuccess {
+		return nil, errors.Errorf("dns query for %s failed: %s", fqdn, resp.Header.RCode)
+	}
+
+	var answers []DNSAnswer
+	for _, answer := range resp.Answers {
+		a, ok := answer.Body.(*dnsmessage.AResource)
+		if !ok {
+			continue
+		}
+		answers = append(answers, DNSAnswer{
+			Name:   answer.Header.Name.String(),
+			IP:     net.IPv4(a.A[0], a.A[1], a.A[2], a.A[3]),
+			TTL:    time.Duration(answer.Header.TTL) * time.Second,
+			Source: server,
+		})
+	}
+	return answers, nil
+}
+
+func exchangeDNS(ctx context.Context, server, network string, query []byte) (*dnsmessage.Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dnsQueryTimeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 65535)
+	var n int
+	if network == "tcp" {
+		// messages over tcp are prefixed with their length
+		msg := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(msg, uint16(len(query)))
+		copy(msg[2:], query)
+		if _, err := conn.Write(msg); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return nil, err
+		}
+		n = int(binary.BigEndian.Uint16(buf[:2]))
+		if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		if n, err = conn.Read(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &dnsmessage.Message{}
+	if err := resp.Unpack(buf[:n]); err != nil {
+		return nil, errors.Wrap(err, "invalid dns answer")
+	}
+	return resp, nil
+}
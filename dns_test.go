@@ -1,8 +1,13 @@
 package go_weave_api
 
 import (
+	"context"
+	"github.com/docker/docker/api/types/container"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestWeave_AddDNS(t *testing.T) {
@@ -52,3 +57,133 @@ func TestWeave_RemoveDNS(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, 2, len(status.DNS))
 }
+
+// newFakeDNSServer answers the A query for box.weave.local. with 10.32.0.1
+// and NXDOMAIN for other names.
+func newFakeDNSServer(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.Header.ID, Response: true},
+				Questions: query.Questions,
+			}
+			q := query.Questions[0]
+			if q.Name.String() == "box.weave.local." {
+				resp.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 30},
+					Body:   &dnsmessage.AResource{A: [4]byte{10, 32, 0, 1}},
+				}}
+			} else {
+				resp.Header.RCode = dnsmessage.RCodeNameError
+			}
+			packed, _ := resp.Pack()
+			_, _ = conn.WriteTo(packed, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestWeave_LookupDNSRecords(t *testing.T) {
+	w := &Weave{dns: NewDNSServer(newFakeDNSServer(t), "weave.local.", false)}
+
+	answers, err := w.LookupDNSRecords(context.Background(), "box", DNSLookupWeaveOnly)
+	require.NoError(t, err)
+	require.Len(t, answers, 1)
+	require.Equal(t, "box.weave.local.", answers[0].Name)
+	require.Equal(t, "10.32.0.1", answers[0].IP.String())
+	require.Equal(t, 30*time.Second, answers[0].TTL)
+	require.Equal(t, w.dns.Address, answers[0].Source)
+
+	answers, err = w.LookupDNSRecords(context.Background(), "box.weave.local", DNSLookupWeaveOnly)
+	require.NoError(t, err)
+	require.Len(t, answers, 1)
+
+	answers, err = w.LookupDNSRecords(context.Background(), "unknown.example.", DNSLookupWeaveOnly)
+	require.NoError(t, err)
+	require.Empty(t, answers)
+
+	// the resolver of this host knows localhost
+	answers, err = w.LookupDNSRecords(context.Background(), "localhost", DNSLookupWithFallback)
+	require.NoError(t, err)
+	require.NotEmpty(t, answers)
+	require.Equal(t, DNSSourceSystem, answers[0].Source)
+
+	w.dns.Disabled = true
+	_, err = w.LookupDNSRecords(context.Background(), "box", DNSLookupWeaveOnly)
+	require.Error(t, err)
+}
+
+func TestDNSServer_LaunchArgs(t *testing.T) {
+	w := &Weave{dns: &DNSServer{Search: "weave.local"}}
+	for _, opt := range []Option{WithDNSDomain("cluster.example"), WithDNSTTL(30),
+		WithDNSEffectiveListenAddress("172.17.0.1:5353")} {
+		opt(w)
+	}
+	require.Equal(t, []string{"--dns-domain", "cluster.example.", "--dns-ttl", "30",
+		"--dns-effective-listen-address", "172.17.0.1:5353"}, w.dns.launchArgs())
+
+	NoDNS()(w)
+	require.Equal(t, []string{"--no-dns"}, w.dns.launchArgs())
+}
+
+func TestWeave_LookupDNSRecordsFallback(t *testing.T) {
+	fallback := newFakeDNSServer(t)
+	w := &Weave{dns: NewDNSServer("", "weave.local.", true)}
+	WithDNSFallback(fallback)(w)
+
+	answers, err := w.LookupDNSRecords(context.Background(), "box.weave.local", DNSLookupWithFallback)
+	require.NoError(t, err)
+	require.Len(t, answers, 1)
+	require.Equal(t, fallback, answers[0].Source)
+
+	w.dns.Fallback = []string{"127.0.0.1"}
+	require.Equal(t, []string{"127.0.0.1:53"}, w.dns.fallbackServers())
+}
+
+func TestDNSServer_ValidateFallback(t *testing.T) {
+	dns := &DNSServer{Fallback: []string{"1.1.1.1", "8.8.8.8:53"}}
+	require.NoError(t, dns.validateFallback())
+	// the resolv.conf of the router has no ports
+	dns.Fallback = []string{"1.1.1.1:5353"}
+	require.Error(t, dns.validateFallback())
+	dns.Fallback = []string{"resolver"}
+	require.Error(t, dns.validateFallback())
+}
+
+func TestWeave_DNSArgs(t *testing.T) {
+	w := &Weave{dns: NewDNSServer("172.17.0.1:53", "weave.local", false)}
+	args, err := w.DNSArgs()
+	require.NoError(t, err)
+	require.Equal(t, []string{"--dns=172.17.0.1", "--dns-search=weave.local."}, args.DockerArgs())
+
+	hostConfig := &container.HostConfig{DNS: []string{"8.8.8.8", "172.17.0.1"}, DNSSearch: []string{"example.com"}}
+	args.ApplyHostConfig(hostConfig)
+	require.Equal(t, []string{"172.17.0.1", "8.8.8.8"}, hostConfig.DNS)
+	require.Equal(t, []string{"weave.local.", "example.com"}, hostConfig.DNSSearch)
+	require.Empty(t, hostConfig.DNSOptions)
+
+	w.dns.Address = "172.17.0.1:5353"
+	_, err = w.DNSArgs()
+	require.Error(t, err)
+	w.dns.EffectiveAddress = "172.17.0.1:53"
+	_, err = w.DNSArgs()
+	require.NoError(t, err)
+
+	w.dns.Disabled = true
+	_, err = w.DNSArgs()
+	require.Error(t, err)
+}
@@ -0,0 +1,258 @@
+package go_weave_api
+
+import (
+	"context"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDNSLabel is the container label read by the DNSController, its value
+// is a comma separated list of names, e.g. weave.dns=web.weave.local,www
+const DefaultDNSLabel = "weave.dns"
+
+// DefaultDNSAttachTimeout is how long the DNSController waits for a started
+// container to get a weave address.
+const DefaultDNSAttachTimeout = time.Minute
+
+const (
+	dnsAttachInterval    = 100 * time.Millisecond
+	dnsAttachMaxInterval = 5 * time.Second
+)
+
+type dnsRegistration struct {
+	ip    string
+	names []string
+}
+
+// DNSController keeps the weaveDNS names of the labeled containers of the
+// node's docker daemon up to date. The names of a container are added once
+// weave attached it after it started and removed when it dies or is destroyed.
+type DNSController struct {
+	w     *Weave
+	label string
+	// ErrorHandler is called with the errors of single containers, which do
+	// not stop the controller. The errors are dropped when it is nil.
+	ErrorHandler func(containerId string, err error)
+	// AttachTimeout is how long a started container is polled for its weave
+	// address, weave attaches a container after it started. It is
+	// DefaultDNSAttachTimeout when zero.
+	AttachTimeout time.Duration
+
+	mu         sync.Mutex
+	registered map[string]dnsRegistration
+	pending    map[string]*pendingRegistration
+}
+
+// pendingRegistration is a started container waiting for its weave address.
+type pendingRegistration struct {
+	cancel context.CancelFunc
+}
+
+func NewDNSController(w *Weave, label string) *DNSController {
+	if label == "" {
+		label = DefaultDNSLabel
+	}
+	return &DNSController{
+		w:          w,
+		label:      label,
+		registered: make(map[string]dnsRegistration),
+		pending:    make(map[string]*pendingRegistration),
+	}
+}
+
+// Run registers the names of the running labeled containers and then follows
+// the docker events until ctx is done or the event stream fails.
+func (c *DNSController) Run(ctx context.Context) error {
+	if c.w.dns.Disabled {
+		return errDNSDisabled
+	}
+	// subscribe first, so no container started during the reconcile is missed
+	messages, errs := c.w.dockerCli.Events(ctx, types.EventsOptions{Filters: filters.NewArgs(
+		filters.Arg("type", "container"),
+		filters.Arg("event", "start"),
+		filters.Arg("event", "die"),
+		filters.Arg("event", "destroy"),
+		filters.Arg("label", c.label),
+	)})
+	if err := c.Reconcile(ctx); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.Wrap(err, "docker event stream failed")
+		case msg := <-messages:
+			c.handleEvent(ctx, msg)
+		}
+	}
+}
+
+// Reconcile registers the names of all running containers with the label.
+func (c *DNSController) Reconcile(ctx context.Context) error {
+	containers, err := c.w.dockerCli.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", c.label)),
+	})
+	if err != nil {
+		return err
+	}
+	for _, ctr := range containers {
+		if err := c.register(ctx, ctr.ID, ctr.Labels[c.label]); err != nil {
+			c.handleError(ctr.ID, err)
+		}
+	}
+	return nil
+}
+
+func (c *DNSController) handleEvent(ctx context.Context, msg events.Message) {
+	var err error
+	switch msg.Action {
+	case "start":
+		c.registerWhenAttached(ctx, msg.Actor.ID, msg.Actor.Attributes[c.label])
+	case "die", "destroy":
+		c.cancelPending(msg.Actor.ID)
+		err = c.unregister(msg.Actor.ID, msg.Actor.Attributes[c.label])
+	}
+	if err != nil {
+		c.handleError(msg.Actor.ID, err)
+	}
+}
+
+func (c *DNSController) register(ctx context.Context, containerId, labelValue string) error {
+	names := splitDNSLabel(labelValue)
+	if len(names) == 0 {
+		return nil
+	}
+	addrs, err := c.w.containerAddrs(ctx, containerId)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return errors.Errorf("container %s has no weave address", containerId)
+	}
+	return c.add(containerId, addrs[0], names)
+}
+
+// registerWhenAttached registers the names of a started container in the
+// background. Weave attaches a container after it started, so its address is
+// polled with a growing interval until it is attached, it dies or
+// AttachTimeout passes.
+func (c *DNSController) registerWhenAttached(ctx context.Context, containerId, labelValue string) {
+	names := splitDNSLabel(labelValue)
+	if len(names) == 0 {
+		return
+	}
+	timeout := c.AttachTimeout
+	if timeout <= 0 {
+		timeout = DefaultDNSAttachTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	pending := &pendingRegistration{cancel: cancel}
+	c.mu.Lock()
+	if previous, ok := c.pending[containerId]; ok {
+		previous.cancel()
+	}
+	c.pending[containerId] = pending
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			cancel()
+			c.mu.Lock()
+			if c.pending[containerId] == pending {
+				delete(c.pending, containerId)
+			}
+			c.mu.Unlock()
+		}()
+		interval := dnsAttachInterval
+		for {
+			addrs, err := c.w.containerAddrs(ctx, containerId)
+			if err == nil && len(addrs) > 0 {
+				if err := c.add(containerId, addrs[0], names); err != nil {
+					c.handleError(containerId, err)
+				}
+				return
+			}
+			select {
+			case <-ctx.Done():
+				// a canceled registration died or the controller stopped
+				if ctx.Err() == context.DeadlineExceeded {
+					c.handleError(containerId, errors.Errorf("container %s has no weave address after %s", containerId, timeout))
+				}
+				return
+			case <-time.After(interval):
+			}
+			if interval *= 2; interval > dnsAttachMaxInterval {
+				interval = dnsAttachMaxInterval
+			}
+		}
+	}()
+}
+
+func (c *DNSController) cancelPending(containerId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pending, ok := c.pending[containerId]; ok {
+		pending.cancel()
+		delete(c.pending, containerId)
+	}
+}
+
+// add registers the names with the ip of the cidr.
+func (c *DNSController) add(containerId, cidr string, names []string) error {
+	ip, _, _ := strings.Cut(cidr, "/")
+	for _, name := range names {
+		if err := c.w.dns.addWeaveDNS(containerId, ip, name, false); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	c.registered[containerId] = dnsRegistration{ip: ip, names: names}
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *DNSController) unregister(containerId, labelValue string) error {
+	c.mu.Lock()
+	registration, ok := c.registered[containerId]
+	delete(c.registered, containerId)
+	c.mu.Unlock()
+	if !ok {
+		// registered before the controller started, the address is released
+		// already, so the names are removed from all addresses
+		registration = dnsRegistration{names: splitDNSLabel(labelValue)}
+	}
+
+	for _, name := range registration.names {
+		if err := c.w.dns.removeWeaveDNS(containerId, registration.ip, name, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *DNSController) handleError(containerId string, err error) {
+	if c.ErrorHandler != nil {
+		c.ErrorHandler(containerId, err)
+	}
+}
+
+func splitDNSLabel(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
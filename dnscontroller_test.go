@@ -0,0 +1,127 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/events"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDNSController(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.41/containers/json", func(rw http.ResponseWriter, r *http.Request) {
+		require.Contains(t, r.URL.Query().Get("filters"), "weave.dns")
+		fmt.Fprint(rw, `[{"Id":"90440c9f28af","Labels":{"weave.dns":"web.weave.local, www"}},
+{"Id":"4d1b2c3e4f5a","Labels":{"weave.dns":"db"}}]`)
+	})
+	mux.HandleFunc("/ip/90440c9f28af", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "10.32.0.1/12")
+	})
+	mux.HandleFunc("/ip/", func(rw http.ResponseWriter, r *http.Request) {
+		http.NotFound(rw, r)
+	})
+	mux.HandleFunc("/name/", func(rw http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		mu.Lock()
+		calls = append(calls, fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, r.Form.Get("fqdn")))
+		mu.Unlock()
+	})
+	w := newFakeDockerRouter(t, mux)
+
+	controller := NewDNSController(w, "")
+	failed := make(map[string]error)
+	controller.ErrorHandler = func(containerId string, err error) {
+		failed[containerId] = err
+	}
+	require.NoError(t, controller.Reconcile(context.Background()))
+	require.Equal(t, []string{
+		"PUT /name/90440c9f28af/10.32.0.1 web.weave.local.",
+		"PUT /name/90440c9f28af/10.32.0.1 www.weave.local.",
+	}, calls)
+	// the second container is not attached to weave
+	require.Len(t, failed, 1)
+	require.Error(t, failed["4d1b2c3e4f5a"])
+
+	calls = nil
+	controller.handleEvent(context.Background(), events.Message{Action: "die",
+		Actor: events.Actor{ID: "90440c9f28af", Attributes: map[string]string{"weave.dns": "web.weave.local., www"}}})
+	controller.handleEvent(context.Background(), events.Message{Action: "destroy",
+		Actor: events.Actor{ID: "8a7b6c5d4e3f", Attributes: map[string]string{"weave.dns": "old"}}})
+	require.Equal(t, []string{
+		"DELETE /name/90440c9f28af/10.32.0.1 web.weave.local.",
+		"DELETE /name/90440c9f28af/10.32.0.1 www.weave.local.",
+		"DELETE /name/8a7b6c5d4e3f old.weave.local.",
+	}, calls)
+}
+
+func TestDNSController_Start(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	lookups := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ip/7e57ab1e0000", func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// weave attaches the container after it started
+		if lookups++; lookups < 3 {
+			http.NotFound(rw, r)
+			return
+		}
+		fmt.Fprint(rw, "10.32.0.7/12")
+	})
+	mux.HandleFunc("/ip/", func(rw http.ResponseWriter, r *http.Request) {
+		http.NotFound(rw, r)
+	})
+	mux.HandleFunc("/name/", func(rw http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		mu.Lock()
+		calls = append(calls, fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, r.Form.Get("fqdn")))
+		mu.Unlock()
+	})
+	w := newFakeDockerRouter(t, mux)
+
+	controller := NewDNSController(w, "")
+	controller.AttachTimeout = 500 * time.Millisecond
+	failed := make(chan string, 1)
+	controller.ErrorHandler = func(containerId string, err error) {
+		failed <- containerId
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	controller.handleEvent(ctx, events.Message{Action: "start",
+		Actor: events.Actor{ID: "7e57ab1e0000", Attributes: map[string]string{"weave.dns": "cache"}}})
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(calls) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"PUT /name/7e57ab1e0000/10.32.0.7 cache.weave.local."}, calls)
+
+	// a container which is never attached is reported after AttachTimeout
+	controller.handleEvent(ctx, events.Message{Action: "start",
+		Actor: events.Actor{ID: "4d1b2c3e4f5a", Attributes: map[string]string{"weave.dns": "db"}}})
+	select {
+	case id := <-failed:
+		require.Equal(t, "4d1b2c3e4f5a", id)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the unattached container is not reported")
+	}
+
+	// and one which dies before it is attached is dropped
+	controller.AttachTimeout = 200 * time.Millisecond
+	controller.handleEvent(ctx, events.Message{Action: "start",
+		Actor: events.Actor{ID: "8a7b6c5d4e3f", Attributes: map[string]string{"weave.dns": "old"}}})
+	controller.handleEvent(ctx, events.Message{Action: "die",
+		Actor: events.Actor{ID: "8a7b6c5d4e3f", Attributes: map[string]string{"weave.dns": "old"}}})
+	select {
+	case id := <-failed:
+		t.Fatalf("container %s is reported after it died", id)
+	case <-time.After(400 * time.Millisecond):
+	}
+}
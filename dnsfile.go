@@ -0,0 +1,273 @@
+package go_weave_api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type DNSFileFormat int
+
+const (
+	// DNSFileHosts is the /etc/hosts format, one address and its names per line
+	DNSFileHosts DNSFileFormat = iota
+	// DNSFileZone is a RFC 1035 zone file with A records
+	DNSFileZone
+)
+
+// DNSConflict is an imported record whose name already points at another
+// address in weaveDNS.
+type DNSConflict struct {
+	Record   DNSRecord
+	Existing []string
+}
+
+// DNSInvalidRecord is an imported record whose name is not a valid hostname.
+type DNSInvalidRecord struct {
+	Record DNSRecord
+	Reason string
+}
+
+// DNSImportReport lists the records added by ImportDNS, or the records which
+// would be added in a dry run.
+type DNSImportReport struct {
+	DryRun    bool
+	Added     []DNSRecord
+	Existing  []DNSRecord
+	Conflicts []DNSConflict
+	Invalid   []DNSInvalidRecord
+}
+
+// ExportDNS writes the weaveDNS entries matching q to out.
+func (w *Weave) ExportDNS(ctx context.Context, out io.Writer, format DNSFileFormat, q DNSQuery) error {
+	idx, err := w.DNSIndex(ctx)
+	if err != nil {
+		return err
+	}
+	entries := idx.Find(q)
+	switch format {
+	case DNSFileHosts:
+		return writeHostsFile(out, idx, entries)
+	case DNSFileZone:
+		ttl := w.dns.TTL
+		if ttl == 0 {
+			ttl = 1
+		}
+		return writeZoneFile(out, idx, entries, ttl)
+	}
+	return errors.Errorf("unknown dns file format %d", format)
+}
+
+// ImportDNS reads the records of in and adds them as external records. A
+// record whose name already points at another address is a conflict and is
+// not added, with dryRun nothing is added. The names are validated before
+// anything is added, a file with an invalid name is reported with its invalid
+// records and an error, and nothing of it is added.
+func (w *Weave) ImportDNS(ctx context.Context, in io.Reader, format DNSFileFormat, dryRun bool) (*DNSImportReport, error) {
+	var records []DNSRecord
+	var err error
+	switch format {
+	case DNSFileHosts:
+		records, err = parseHostsFile(in)
+	case DNSFileZone:
+		records, err = parseZoneFile(in, w.dns.Search)
+	default:
+		err = errors.Errorf("unknown dns file format %d", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	report := &DNSImportReport{DryRun: dryRun}
+	for _, record := range records {
+		if _, err := w.dns.fqdn(record.Hostname); err != nil {
+			report.Invalid = append(report.Invalid, DNSInvalidRecord{Record: record, Reason: err.Error()})
+		}
+	}
+	if len(report.Invalid) > 0 {
+		return report, errors.Errorf("%d invalid dns records, nothing is imported", len(report.Invalid))
+	}
+
+	idx, err := w.DNSIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make(map[string][]string)
+	for _, entry := range idx.entries {
+		name := idx.FQDN(entry)
+		if !containsString(addresses[name], entry.Address) {
+			addresses[name] = append(addresses[name], entry.Address)
+		}
+	}
+
+	for _, record := range records {
+		name := idx.FQDN(DNSStatus{Hostname: record.Hostname})
+		existing := addresses[name]
+		switch {
+		case len(existing) == 0:
+			report.Added = append(report.Added, record)
+		case containsString(existing, record.Address):
+			report.Existing = append(report.Existing, record)
+		default:
+			report.Conflicts = append(report.Conflicts, DNSConflict{Record: record, Existing: existing})
+		}
+		// later records of the same file for this name are not conflicts
+		if !containsString(existing, record.Address) {
+			addresses[name] = append(existing, record.Address)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	for _, record := range report.Added {
+		if err := w.AddExternalDNS(record.Address, record.Hostname); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func writeHostsFile(out io.Writer, idx *DNSIndex, entries []DNSStatus) error {
+	var addresses []string
+	names := make(map[string][]string)
+	for _, entry := range entries {
+		if _, ok := names[entry.Address]; !ok {
+			addresses = append(addresses, entry.Address)
+		}
+		name := strings.TrimSuffix(idx.FQDN(entry), ".")
+		if !containsString(names[entry.Address], name) {
+			names[entry.Address] = append(names[entry.Address], name)
+		}
+	}
+	sort.Strings(addresses)
+
+	bw := bufio.NewWriter(out)
+	for _, address := range addresses {
+		fmt.Fprintf(bw, "%s\t%s\n", address, strings.Join(names[address], " "))
+	}
+	return bw.Flush()
+}
+
+func writeZoneFile(out io.Writer, idx *DNSIndex, entries []DNSStatus, ttl int) error {
+	origin := strings.TrimSuffix(idx.domain, ".") + "."
+	seen := make(map[string]struct{})
+	var lines []string
+	for _, entry := range entries {
+		line := fmt.Sprintf("%s\t%d\tIN\tA\t%s", idx.FQDN(entry), ttl, entry.Address)
+		if _, ok := seen[line]; ok {
+			continue
+		}
+		seen[line] = struct{}{}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+
+	bw := bufio.NewWriter(out)
+	fmt.Fprintf(bw, "$ORIGIN %s\n$TTL %d\n", origin, ttl)
+	for _, line := range lines {
+		fmt.Fprintln(bw, line)
+	}
+	return bw.Flush()
+}
+
+// parseHostsFile reads the ipv4 entries of a hosts file, weaveDNS has no ipv6
+// records so the ipv6 entries like ::1 localhost are skipped.
+func parseHostsFile(in io.Reader) ([]DNSRecord, error) {
+	var records []DNSRecord
+	scanner := bufio.NewScanner(in)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if len(fields) < 2 || ip == nil {
+			return nil, errors.Errorf("invalid hosts entry at line %d", n)
+		}
+		if ip.To4() == nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			records = append(records, DNSRecord{Hostname: name, Address: fields[0]})
+		}
+	}
+	return records, scanner.Err()
+}
+
+// parseZoneFile reads the A records of a zone file, the other records are
+// skipped. Relative names are qualified with $ORIGIN, or with domain when the
+// file has none. Multi-line records are not supported.
+func parseZoneFile(in io.Reader, domain string) ([]DNSRecord, error) {
+	origin := strings.TrimSuffix(domain, ".") + "."
+	var records []DNSRecord
+	var last string
+	scanner := bufio.NewScanner(in)
+	for n := 1; scanner.Scan(); n++ {
+		raw, _, _ := strings.Cut(scanner.Text(), ";")
+		fields := strings.Fields(raw)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "$ORIGIN" {
+			if len(fields) != 2 {
+				return nil, errors.Errorf("invalid $ORIGIN at line %d", n)
+			}
+			origin = strings.TrimSuffix(fields[1], ".") + "."
+			continue
+		}
+		if strings.HasPrefix(fields[0], "$") {
+			continue
+		}
+
+		// a line starting with a blank continues the owner of the previous record
+		owner := last
+		if raw[0] != ' ' && raw[0] != '\t' {
+			owner = fields[0]
+			fields = fields[1:]
+		}
+		// skip the optional ttl and class before the type
+		for len(fields) > 0 {
+			if _, err := strconv.Atoi(fields[0]); err == nil || fields[0] == "IN" {
+				fields = fields[1:]
+				continue
+			}
+			break
+		}
+		if len(fields) < 2 {
+			return nil, errors.Errorf("invalid record at line %d", n)
+		}
+		last = owner
+		if fields[0] != "A" {
+			continue
+		}
+		if net.ParseIP(fields[1]).To4() == nil {
+			return nil, errors.Errorf("invalid A record at line %d", n)
+		}
+
+		name := owner
+		switch {
+		case name == "@":
+			name = origin
+		case !strings.HasSuffix(name, "."):
+			name = name + "." + origin
+		}
+		records = append(records, DNSRecord{Hostname: name, Address: fields[1]})
+	}
+	return records, scanner.Err()
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
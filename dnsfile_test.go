@@ -0,0 +1,106 @@
+package go_weave_api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDNSFiles(t *testing.T) {
+	idx := NewDNSIndex(parseDNSStatus([]byte(testDNSStatus)), "weave.local.")
+
+	var hosts bytes.Buffer
+	require.NoError(t, writeHostsFile(&hosts, idx, idx.Find(DNSQuery{})))
+	require.Equal(t, "10.32.0.1\tbox.weave.local box-alias.weave.local\n"+
+		"10.40.0.1\tdb.weave.local\n"+
+		"180.101.49.11\tapi.weave.local\n", hosts.String())
+
+	records, err := parseHostsFile(&hosts)
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	require.Equal(t, DNSRecord{Hostname: "box-alias.weave.local", Address: "10.32.0.1"}, records[1])
+
+	var zone bytes.Buffer
+	require.NoError(t, writeZoneFile(&zone, idx, idx.Find(DNSQuery{Kind: DNSKindContainer}), 30))
+	require.Equal(t, "$ORIGIN weave.local.\n$TTL 30\n"+
+		"box-alias.weave.local.\t30\tIN\tA\t10.32.0.1\n"+
+		"box.weave.local.\t30\tIN\tA\t10.32.0.1\n"+
+		"db.weave.local.\t30\tIN\tA\t10.40.0.1\n", zone.String())
+
+	records, err = parseZoneFile(strings.NewReader(`$ORIGIN example.weave.local.
+$TTL 60
+@        IN  SOA ns1 admin 1 3600 600 86400 60
+web      300 IN  A  10.32.1.1 ; comment
+         IN  A  10.32.1.2
+mail     IN  MX 10 web
+api.weave.local. A 10.32.1.3
+`), "weave.local")
+	require.NoError(t, err)
+	require.Equal(t, []DNSRecord{
+		{Hostname: "web.example.weave.local.", Address: "10.32.1.1"},
+		{Hostname: "web.example.weave.local.", Address: "10.32.1.2"},
+		{Hostname: "api.weave.local.", Address: "10.32.1.3"},
+	}, records)
+
+	_, err = parseHostsFile(strings.NewReader("box 10.32.0.1\n"))
+	require.Error(t, err)
+	records, err = parseHostsFile(strings.NewReader("127.0.0.1 localhost\n::1 localhost ip6-localhost\n"))
+	require.NoError(t, err)
+	require.Equal(t, []DNSRecord{{Hostname: "localhost", Address: "127.0.0.1"}}, records)
+	_, err = parseZoneFile(strings.NewReader("web IN A box\n"), "weave.local")
+	require.Error(t, err)
+}
+
+func TestWeave_ImportDNS(t *testing.T) {
+	var mu sync.Mutex
+	var added []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status/dns", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, testDNSStatus)
+	})
+	mux.HandleFunc("/name/", func(rw http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		mu.Lock()
+		added = append(added, r.URL.Path+" "+r.Form.Get("fqdn"))
+		mu.Unlock()
+	})
+	w := newFakeRouter(t, mux)
+	w.dns.weave = w
+
+	hosts := "10.32.0.1 box\n10.32.0.9 db\n10.32.0.10 web web-alias\n"
+	report, err := w.ImportDNS(context.Background(), strings.NewReader(hosts), DNSFileHosts, true)
+	require.NoError(t, err)
+	require.Len(t, report.Added, 2)
+	require.Equal(t, []DNSRecord{{Hostname: "box", Address: "10.32.0.1"}}, report.Existing)
+	require.Len(t, report.Conflicts, 1)
+	require.Equal(t, []string{"10.40.0.1"}, report.Conflicts[0].Existing)
+	require.Empty(t, added)
+
+	_, err = w.ImportDNS(context.Background(), strings.NewReader(hosts), DNSFileHosts, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"/name/weave:extern/10.32.0.10 web.weave.local.",
+		"/name/weave:extern/10.32.0.10 web-alias.weave.local.",
+	}, added)
+
+	// an invalid name fails the import before anything is added
+	added = nil
+	report, err = w.ImportDNS(context.Background(), strings.NewReader("10.32.0.11 cache\n10.32.0.12 bad_name\n"),
+		DNSFileHosts, true)
+	require.Error(t, err)
+	require.Len(t, report.Invalid, 1)
+	require.Equal(t, DNSRecord{Hostname: "bad_name", Address: "10.32.0.12"}, report.Invalid[0].Record)
+	_, err = w.ImportDNS(context.Background(), strings.NewReader("10.32.0.11 cache\n10.32.0.12 bad_name\n"),
+		DNSFileHosts, false)
+	require.Error(t, err)
+	require.Empty(t, added)
+
+	var out bytes.Buffer
+	require.NoError(t, w.ExportDNS(context.Background(), &out, DNSFileHosts, DNSQuery{IP: "10.40.0.1"}))
+	require.Equal(t, "10.40.0.1\tdb.weave.local\n", out.String())
+}
@@ -0,0 +1,187 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"sort"
+	"strings"
+)
+
+type DNSKind int
+
+const (
+	DNSKindAll DNSKind = iota
+	// DNSKindContainer are the entries of containers
+	DNSKindContainer
+	// DNSKindExternal are the entries added with AddExternalDNS or Expose
+	DNSKindExternal
+)
+
+// DNSQuery filters dns entries, the empty fields match everything.
+type DNSQuery struct {
+	IP string
+	// ContainerId is a full or short container id
+	ContainerId string
+	// Origin is the name of the peer which registered the entry
+	Origin string
+	Kind   DNSKind
+}
+
+// PTRAnswer is the answer of a reverse lookup.
+type PTRAnswer struct {
+	// ReverseName is the in-addr.arpa name of the ip, e.g. 1.0.32.10.in-addr.arpa.
+	ReverseName string
+	// Names are the absolute names pointing at the ip
+	Names []string
+}
+
+// DNSIndex indexes the dns entries by ip, container and origin.
+type DNSIndex struct {
+	domain      string
+	entries     []DNSStatus
+	byIP        map[string][]int
+	byContainer map[string][]int
+	byOrigin    map[string][]int
+}
+
+// DNSIndex queries the dns status of the router and indexes the entries.
+func (w *Weave) DNSIndex(ctx context.Context) (*DNSIndex, error) {
+	if w.dns.Disabled {
+		return nil, errDNSDisabled
+	}
+	status, err := w.status(ctx, "dns")
+	if err != nil {
+		return nil, err
+	}
+	return NewDNSIndex(status.DNS, w.dns.Search), nil
+}
+
+// ReverseLookupDNS returns the weaveDNS names pointing at ip.
+func (w *Weave) ReverseLookupDNS(ctx context.Context, ip string) (*PTRAnswer, error) {
+	idx, err := w.DNSIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return idx.PTR(ip)
+}
+
+// ContainerDNSNames returns the weaveDNS names of a container, registered by any peer.
+func (w *Weave) ContainerDNSNames(ctx context.Context, containerId string) ([]string, error) {
+	idx, err := w.DNSIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return idx.names(idx.Find(DNSQuery{ContainerId: containerId})), nil
+}
+
+// NewDNSIndex indexes entries, domain is the weaveDNS domain the names are qualified with.
+func NewDNSIndex(entries []DNSStatus, domain string) *DNSIndex {
+	idx := &DNSIndex{
+		domain:      domain,
+		entries:     entries,
+		byIP:        make(map[string][]int),
+		byContainer: make(map[string][]int),
+		byOrigin:    make(map[string][]int),
+	}
+	for i, entry := range entries {
+		idx.byIP[entry.Address] = append(idx.byIP[entry.Address], i)
+		idx.byContainer[shortContainerId(entry.ContainerId)] = append(idx.byContainer[shortContainerId(entry.ContainerId)], i)
+		idx.byOrigin[entry.Origin] = append(idx.byOrigin[entry.Origin], i)
+	}
+	return idx
+}
+
+// Find returns the entries matching all the fields set in q.
+func (idx *DNSIndex) Find(q DNSQuery) []DNSStatus {
+	// start from the smallest candidate list of the indexed fields
+	var candidates []int
+	indexed := false
+	narrow := func(positions []int) {
+		if !indexed || len(positions) < len(candidates) {
+			candidates = positions
+		}
+		indexed = true
+	}
+	if q.IP != "" {
+		narrow(idx.byIP[q.IP])
+	}
+	if q.ContainerId != "" {
+		narrow(idx.byContainer[shortContainerId(q.ContainerId)])
+	}
+	if q.Origin != "" {
+		narrow(idx.byOrigin[q.Origin])
+	}
+	if !indexed {
+		candidates = make([]int, len(idx.entries))
+		for i := range candidates {
+			candidates[i] = i
+		}
+	}
+
+	var result []DNSStatus
+	for _, i := range candidates {
+		entry := idx.entries[i]
+		if q.IP != "" && entry.Address != q.IP {
+			continue
+		}
+		if q.ContainerId != "" && shortContainerId(entry.ContainerId) != shortContainerId(q.ContainerId) {
+			continue
+		}
+		if q.Origin != "" && entry.Origin != q.Origin {
+			continue
+		}
+		if q.Kind == DNSKindContainer && isExternalDNSEntry(entry) ||
+			q.Kind == DNSKindExternal && !isExternalDNSEntry(entry) {
+			continue
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// FQDN returns the absolute name of entry in the weaveDNS domain.
+func (idx *DNSIndex) FQDN(entry DNSStatus) string {
+	dns := &DNSServer{Search: idx.domain}
+	return fmt.Sprintf("%s.%s.", dns.relative(entry.Hostname), strings.TrimSuffix(idx.domain, "."))
+}
+
+// PTR returns the names pointing at ip.
+func (idx *DNSIndex) PTR(ip string) (*PTRAnswer, error) {
+	parsed := net.ParseIP(ip).To4()
+	if parsed == nil {
+		return nil, errors.Errorf("invalid ipv4 address %s", ip)
+	}
+	answer := &PTRAnswer{
+		ReverseName: fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", parsed[3], parsed[2], parsed[1], parsed[0]),
+		Names:       idx.names(idx.Find(DNSQuery{IP: parsed.String()})),
+	}
+	return answer, nil
+}
+
+func (idx *DNSIndex) names(entries []DNSStatus) []string {
+	seen := make(map[string]struct{})
+	var names []string
+	for _, entry := range entries {
+		name := idx.FQDN(entry)
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isExternalDNSEntry(entry DNSStatus) bool {
+	return strings.HasPrefix(entry.ContainerId, "weave:")
+}
+
+func shortContainerId(containerId string) string {
+	if len(containerId) > containerIdPrefixLen {
+		return containerId[:containerIdPrefixLen]
+	}
+	return containerId
+}
@@ -0,0 +1,35 @@
+package go_weave_api
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const testDNSStatus = `api          180.101.49.11   weave:extern 5e:a4:e5:b8:d1:b6
+box          10.32.0.1       90440c9f28af 5e:a4:e5:b8:d1:b6
+box-alias    10.32.0.1       90440c9f28af 5e:a4:e5:b8:d1:b6
+db           10.40.0.1       4d1b2c3e4f5a 3a:8c:e4:ba:50:ee
+db           10.40.0.1       4d1b2c3e4f5a 3a:8c:e4:ba:50:ee
+`
+
+func TestDNSIndex(t *testing.T) {
+	idx := NewDNSIndex(parseDNSStatus([]byte(testDNSStatus)), "weave.local.")
+
+	answer, err := idx.PTR("10.32.0.1")
+	require.NoError(t, err)
+	require.Equal(t, "1.0.32.10.in-addr.arpa.", answer.ReverseName)
+	require.Equal(t, []string{"box-alias.weave.local.", "box.weave.local."}, answer.Names)
+
+	_, err = idx.PTR("box")
+	require.Error(t, err)
+
+	entries := idx.Find(DNSQuery{ContainerId: "90440c9f28af0123456789"})
+	require.Len(t, entries, 2)
+	require.Equal(t, []string{"db.weave.local."}, idx.names(idx.Find(DNSQuery{Origin: "3a:8c:e4:ba:50:ee"})))
+
+	require.Len(t, idx.Find(DNSQuery{Kind: DNSKindExternal}), 1)
+	require.Len(t, idx.Find(DNSQuery{Kind: DNSKindContainer}), 4)
+	require.Len(t, idx.Find(DNSQuery{Origin: "5e:a4:e5:b8:d1:b6", Kind: DNSKindContainer}), 2)
+	require.Empty(t, idx.Find(DNSQuery{IP: "10.40.0.1", Origin: "5e:a4:e5:b8:d1:b6"}))
+	require.Len(t, idx.Find(DNSQuery{}), 5)
+}
@@ -0,0 +1,242 @@
+package go_weave_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+const containerIdPrefixLen = 12
+
+// DNSRecord is a weaveDNS entry, a record without ContainerId is an external one.
+type DNSRecord struct {
+	Hostname    string
+	Address     string
+	ContainerId string
+}
+
+// external reports whether the record belongs to no container, like
+// addWeaveDNS it is an external record or a name of the exposed host.
+func (r DNSRecord) external() bool {
+	return r.ContainerId == "" || r.ContainerId == "weave:extern" || r.ContainerId == "weave:expose"
+}
+
+// owner returns the id the record is registered with, the short id of a
+// container.
+func (r DNSRecord) owner() string {
+	switch {
+	case r.ContainerId == "":
+		return "weave:extern"
+	case r.external():
+		return r.ContainerId
+	}
+	return shortContainerId(r.ContainerId)
+}
+
+// DNSSyncScope selects the local records SyncDNS manages, the records outside
+// of it are never removed. The zero scope manages nothing.
+type DNSSyncScope struct {
+	// External manages the external records of weave:extern
+	External bool
+	// Containers manages the records of the containers, full or short ids,
+	// weave:expose manages the names of the exposed host addresses
+	Containers []string
+}
+
+func (s DNSSyncScope) contains(record DNSRecord) bool {
+	owner := record.owner()
+	if owner == "weave:extern" {
+		return s.External
+	}
+	for _, id := range s.Containers {
+		if id == owner || shortContainerId(id) == owner {
+			return true
+		}
+	}
+	return false
+}
+
+// DNSSyncReport lists the records changed by SyncDNS, or the records which
+// would be changed in a dry run.
+type DNSSyncReport struct {
+	DryRun    bool
+	Added     []DNSRecord
+	Removed   []DNSRecord
+	Unchanged int
+}
+
+// SyncDNS makes the weaveDNS entries of scope owned by this node match
+// desired. Only the entries whose origin is the local peer are compared, so
+// the records of other peers are never removed, and the names registered by
+// Attach or other tools outside of scope are left alone. A desired record
+// outside of scope is an error, as is a changed record of a container whose
+// full id is neither in the router report nor known to docker. With dryRun
+// the changes are computed but not applied.
+func (w *Weave) SyncDNS(ctx context.Context, desired []DNSRecord, scope DNSSyncScope, dryRun bool) (*DNSSyncReport, error) {
+	if w.dns.Disabled {
+		return nil, errDNSDisabled
+	}
+	for _, record := range desired {
+		if !scope.contains(record) {
+			return nil, errors.Errorf("dns record %s %s of %s is outside of the sync scope",
+				record.Hostname, record.Address, record.owner())
+		}
+	}
+	localPeer, err := w.localPeerName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status, err := w.status(ctx, "dns")
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]DNSRecord)
+	for _, entry := range status.DNS {
+		if entry.Origin != localPeer {
+			continue
+		}
+		record := DNSRecord{Hostname: entry.Hostname, Address: entry.Address, ContainerId: entry.ContainerId}
+		if scope.contains(record) {
+			current[w.dns.recordKey(record)] = record
+		}
+	}
+
+	report := &DNSSyncReport{DryRun: dryRun}
+	wanted := make(map[string]struct{}, len(desired))
+	for _, record := range desired {
+		key := w.dns.recordKey(record)
+		if _, ok := wanted[key]; ok {
+			continue
+		}
+		wanted[key] = struct{}{}
+		if _, ok := current[key]; ok {
+			report.Unchanged++
+			continue
+		}
+		report.Added = append(report.Added, record)
+	}
+	for key, record := range current {
+		if _, ok := wanted[key]; !ok {
+			report.Removed = append(report.Removed, record)
+		}
+	}
+	sort.Slice(report.Removed, func(i, j int) bool {
+		return w.dns.recordKey(report.Removed[i]) < w.dns.recordKey(report.Removed[j])
+	})
+
+	// the router keeps the names under the full container ids, a record whose
+	// owner can not be resolved could not be changed
+	fullIds := make(map[string]string)
+	var ids map[string]string
+	for _, record := range append(append([]DNSRecord{}, report.Removed...), report.Added...) {
+		if record.external() {
+			continue
+		}
+		if ids == nil {
+			if ids, err = w.reportContainerIds(ctx); err != nil {
+				return nil, err
+			}
+		}
+		if fullIds[record.ContainerId], err = w.resolveContainerId(ids, record.ContainerId); err != nil {
+			return nil, errors.Wrapf(err, "dns record %s %s", record.Hostname, record.Address)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	for _, record := range report.Removed {
+		if record.external() {
+			err = w.dns.removeWeaveDNS(record.owner(), record.Address, record.Hostname, true)
+		} else {
+			err = w.dns.removeWeaveDNS(fullIds[record.ContainerId], record.Address, record.Hostname, false)
+		}
+		if err != nil {
+			return report, err
+		}
+	}
+	for _, record := range report.Added {
+		if record.external() {
+			err = w.dns.addWeaveDNS(record.owner(), record.Address, record.Hostname, true)
+		} else {
+			err = w.dns.addWeaveDNS(fullIds[record.ContainerId], record.Address, record.Hostname, false)
+		}
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// localPeerName returns the name of the router's own peer, which is the
+// origin of the dns entries it registers.
+func (w *Weave) localPeerName(ctx context.Context) (string, error) {
+	status, err := w.status(ctx, "")
+	if err != nil {
+		return "", err
+	}
+	name, _ := parsePeerName(status.Overview.Router.Name)
+	return name, nil
+}
+
+// fullContainerIdLen is the length of a full docker container id.
+const fullContainerIdLen = 64
+
+// dnsReport is the dns part of the router report, unlike the dns status its
+// entries hold the full container ids.
+type dnsReport struct {
+	DNS struct {
+		Entries []struct {
+			ContainerID string
+		}
+	}
+}
+
+// reportContainerIds returns the full ids of the containers with dns entries
+// by their short id, read from the router report.
+func (w *Weave) reportContainerIds(ctx context.Context) (map[string]string, error) {
+	raw, err := w.Report(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var report dnsReport
+	if err := json.Unmarshal(raw, &report); err != nil {
+		return nil, errors.Wrap(err, "invalid router report")
+	}
+	ids := make(map[string]string, len(report.DNS.Entries))
+	for _, entry := range report.DNS.Entries {
+		if len(entry.ContainerID) == fullContainerIdLen {
+			ids[shortContainerId(entry.ContainerID)] = entry.ContainerID
+		}
+	}
+	return ids, nil
+}
+
+// resolveContainerId expands a short container id with the ids of
+// reportContainerIds, or by inspecting the container. The router keeps
+// names and addresses under the full id, so an id which can not be expanded,
+// e.g. of a removed container without dns entry, is an error.
+func (w *Weave) resolveContainerId(ids map[string]string, containerId string) (string, error) {
+	if len(containerId) == fullContainerIdLen {
+		return containerId, nil
+	}
+	if id, ok := ids[shortContainerId(containerId)]; ok && strings.HasPrefix(id, containerId) {
+		return id, nil
+	}
+	if w.dockerCli != nil {
+		if id, err := getContainerIdByName(w.dockerCli, containerId); err == nil {
+			return id, nil
+		}
+	}
+	return "", errors.Errorf("the full id of container %s is unknown", containerId)
+}
+
+// recordKey identifies a record by its relative hostname, its address and
+// its owner.
+func (dns *DNSServer) recordKey(record DNSRecord) string {
+	return fmt.Sprintf("%s %s %s", dns.relative(record.Hostname), record.Address, record.owner())
+}
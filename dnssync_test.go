@@ -0,0 +1,97 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWeave_SyncDNS(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, testOverviewStatus)
+	})
+	mux.HandleFunc("/status/dns", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `api          180.101.49.11   weave:extern 5e:a4:e5:b8:d1:b6
+old          180.101.49.12   weave:extern 5e:a4:e5:b8:d1:b6
+box          10.32.0.1       90440c9f28af 5e:a4:e5:b8:d1:b6
+web          10.32.0.5       7e57ab1e0000 5e:a4:e5:b8:d1:b6
+host         10.32.0.2       weave:expose 5e:a4:e5:b8:d1:b6
+remote       10.40.0.1       4d1b2c3e4f5a 3a:8c:e4:ba:50:ee
+`)
+	})
+	mux.HandleFunc("/report", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, testReport("90440c9f28af", "7e57ab1e0000", "4d1b2c3e4f5a"))
+	})
+	mux.HandleFunc("/name/", func(rw http.ResponseWriter, r *http.Request) {
+		// the router only knows the full container ids
+		owner := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/name/"), "/", 2)[0]
+		if len(owner) != fullContainerIdLen && !strings.HasPrefix(owner, "weave:") {
+			http.NotFound(rw, r)
+			return
+		}
+		require.NoError(t, r.ParseForm())
+		mu.Lock()
+		calls = append(calls, fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, r.Form.Get("fqdn")))
+		mu.Unlock()
+	})
+	w := newFakeRouter(t, mux)
+	w.dns.weave = w
+
+	desired := []DNSRecord{
+		{Hostname: "api.weave.local.", Address: "180.101.49.11"},
+		{Hostname: "new", Address: "180.101.49.13"},
+		{Hostname: "box", Address: "10.32.0.1", ContainerId: "90440c9f28af1b2c3d4e5f"},
+	}
+
+	scope := DNSSyncScope{External: true, Containers: []string{"90440c9f28af1b2c3d4e5f"}}
+	report, err := w.SyncDNS(context.Background(), desired, scope, true)
+	require.NoError(t, err)
+	require.True(t, report.DryRun)
+	require.Equal(t, 2, report.Unchanged)
+	require.Equal(t, []DNSRecord{desired[1]}, report.Added)
+	// the records of the remote peer and outside of the scope are left alone
+	require.Equal(t, []DNSRecord{{Hostname: "old", Address: "180.101.49.12", ContainerId: "weave:extern"}}, report.Removed)
+	require.Empty(t, calls)
+
+	report, err = w.SyncDNS(context.Background(), desired, scope, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"DELETE /name/weave:extern/180.101.49.12 old.weave.local.",
+		"PUT /name/weave:extern/180.101.49.13 new.weave.local.",
+	}, calls)
+
+	// the names of the exposed host stay weave:expose records
+	calls = nil
+	_, err = w.SyncDNS(context.Background(), []DNSRecord{{Hostname: "gateway", Address: "10.32.0.2", ContainerId: "weave:expose"}},
+		DNSSyncScope{Containers: []string{"weave:expose"}}, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"DELETE /name/weave:expose/10.32.0.2 host.weave.local.",
+		"PUT /name/weave:expose/10.32.0.2 gateway.weave.local.",
+	}, calls)
+
+	// the records of a removed container are found by its full id
+	calls = nil
+	report, err = w.SyncDNS(context.Background(), nil, DNSSyncScope{Containers: []string{"7e57ab1e0000"}}, false)
+	require.NoError(t, err)
+	require.Len(t, report.Removed, 1)
+	require.Equal(t, []string{"DELETE /name/" + testFullId("7e57ab1e0000") + "/10.32.0.5 web.weave.local."}, calls)
+
+	// an owner which can not be resolved is an error, also in a dry run
+	calls = nil
+	_, err = w.SyncDNS(context.Background(), []DNSRecord{{Hostname: "db", Address: "10.32.0.6", ContainerId: "c0ffee000000"}},
+		DNSSyncScope{Containers: []string{"c0ffee000000"}}, true)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "c0ffee000000")
+	require.Empty(t, calls)
+
+	_, err = w.SyncDNS(context.Background(), desired, DNSSyncScope{External: true}, true)
+	require.Error(t, err)
+}
@@ -0,0 +1,378 @@
+package go_weave_api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// exposeStateCmd prints the addresses of the weave bridge and the iptables
+// rules of expose, each part after a marker line.
+const exposeStateCmd = `
+echo '#addr'; ip -4 -o addr show dev weave 2>/dev/null
+echo '#nat'; iptables -w -t nat -S WEAVE 2>/dev/null
+echo '#filter'; iptables -w -t filter -S WEAVE_EXPOSE 2>/dev/null
+true
+`
+
+// hideCmd removes an exposed address from the weave bridge, the address is
+// skipped when it is missing already. The rules of hideRulesCmd are appended
+// when they are removed as well.
+const hideCmd = `
+fail=0
+if ip -4 -o addr show dev weave | grep -q " %[1]s "; then
+	ip addr del dev weave %[1]s || fail=1
+fi
+%[2]s
+exit $fail
+`
+
+// hideRulesCmd removes the iptables rules of expose for the subnet of an
+// address, the missing rules are skipped.
+const hideRulesCmd = `
+for rule in "nat WEAVE -d %[1]s ! -s %[1]s -j MASQUERADE" \
+	"nat WEAVE -s %[1]s ! -d %[1]s -j MASQUERADE" \
+	"filter WEAVE_EXPOSE -d %[1]s -j ACCEPT"; do
+	set -- $rule
+	table=$1
+	shift
+	if iptables -w -t $table -C "$@" 2>/dev/null; then
+		iptables -w -t $table -D "$@" || fail=1
+	fi
+done
+`
+
+// ExposedAddress is the expose state of a host address. iptables stores the
+// rules with the subnet of the address, so the rules of addresses in the same
+// subnet are shared.
+type ExposedAddress struct {
+	Address netip.Prefix
+	// IPAM is true when the address is owned by weave:expose
+	IPAM bool
+	// Bridge is true when the address is on the weave bridge
+	Bridge bool
+	// MasqueradeRules is the number of the two WEAVE nat rules, 0 when the
+	// address is exposed without masquerade
+	MasqueradeRules int
+	// Accept is true when the WEAVE_EXPOSE rule accepts the address
+	Accept bool
+	// Problems describe the inconsistencies of the state, empty when the
+	// address is fully exposed
+	Problems []string
+}
+
+func (e *ExposedAddress) Consistent() bool {
+	return len(e.Problems) == 0
+}
+
+type ExposeRepair int
+
+const (
+	// RepairExpose exposes the inconsistent addresses again
+	RepairExpose ExposeRepair = iota
+	// RepairHide hides the inconsistent addresses
+	RepairHide
+)
+
+// ListExposed combines the addresses owned by weave:expose in ipam, the
+// addresses of the weave bridge and the WEAVE and WEAVE_EXPOSE iptables rules.
+// Rules without an address are listed with the subnet of the rule.
+func (w *Weave) ListExposed(ctx context.Context) ([]ExposedAddress, error) {
+	owned, err := w.ContainerAddresses(ctx, "weave:expose")
+	if err != nil {
+		return nil, err
+	}
+	bridge, rules, err := w.exposeState()
+	if err != nil {
+		return nil, err
+	}
+	return exposedAddresses(owned, bridge, rules, w.ipRangeSubnet()), nil
+}
+
+// exposeState reads the addresses of the weave bridge and the expose rules.
+func (w *Weave) exposeState() ([]netip.Prefix, exposeRules, error) {
+	result, err := w.runRemoteCmdWithStatus("sh", "-c", exposeStateCmd)
+	if err != nil {
+		return nil, exposeRules{}, err
+	}
+	if result.exitCode != 0 {
+		return nil, exposeRules{}, errors.Errorf("read the expose state: %s", strings.TrimSpace(string(result.stderr)))
+	}
+	return parseExposeState(string(result.stdout))
+}
+
+func (w *Weave) ipRangeSubnet() netip.Prefix {
+	ipRange, _ := netip.ParsePrefix(w.ipRange)
+	return ipRange.Masked()
+}
+
+// RepairExposed brings the inconsistent addresses of ListExposed to a
+// consistent state, exposed or hidden, and returns them as they were before.
+// An address which is only owned in ipam is ambiguous between a failed
+// expose and a failed hide, so the direction is chosen by the caller. Rules
+// without an address are always removed.
+func (w *Weave) RepairExposed(ctx context.Context, repair ExposeRepair) ([]ExposedAddress, error) {
+	exposed, err := w.ListExposed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var bridge []netip.Prefix
+	for _, e := range exposed {
+		if e.Bridge {
+			bridge = append(bridge, e.Address)
+		}
+	}
+	var repaired []ExposedAddress
+	for _, e := range exposed {
+		if e.Consistent() {
+			continue
+		}
+		if repair == RepairHide || (!e.IPAM && !e.Bridge) {
+			bridge = removePrefix(bridge, e.Address)
+			// rules without an address are stale, the rules of an address
+			// which is not on the bridge belong to another one
+			removeRules := (e.Bridge || !e.IPAM) && !sharedRules(e.Address, bridge, w.ipRangeSubnet())
+			err = w.hideAddress(ctx, e.Address, removeRules, e.IPAM)
+		} else {
+			err = w.exposeAddress(ctx, e)
+		}
+		if err != nil {
+			return repaired, errors.Wrapf(err, "repair exposed address %s", e.Address)
+		}
+		repaired = append(repaired, e)
+	}
+	return repaired, nil
+}
+
+func (w *Weave) exposeAddress(ctx context.Context, e ExposedAddress) error {
+	if !e.IPAM {
+		if err := w.claimAddress(ctx, "weave:expose", e.Address); err != nil {
+			return err
+		}
+	}
+	// an address exposed without masquerade has no nat rules, keep it so
+	var skipNAT string
+	if e.Bridge && e.MasqueradeRules == 0 {
+		skipNAT = "?skipNAT=true"
+	}
+	_, err := callWeaveContext(ctx, http.MethodPost, fmt.Sprintf("http://%s:%d/expose/%s%s",
+		w.address, w.httpPort, e.Address, skipNAT), nil)
+	return err
+}
+
+// hideAddress removes the address from the bridge, its rules when removeRules
+// is set, and releases it in ipam when release is set.
+func (w *Weave) hideAddress(ctx context.Context, addr netip.Prefix, removeRules, release bool) error {
+	var rulesCmd string
+	if removeRules {
+		rulesCmd = fmt.Sprintf(hideRulesCmd, addr)
+	}
+	result, err := w.runRemoteCmdWithStatus("sh", "-c", fmt.Sprintf(hideCmd, addr, rulesCmd))
+	if err != nil {
+		return err
+	}
+	if result.exitCode != 0 {
+		return errors.Errorf("hide %s failed with exit code %d: %s", addr, result.exitCode,
+			strings.TrimSpace(string(result.stderr)))
+	}
+	if !release {
+		return nil
+	}
+	_, err = callWeaveContext(ctx, http.MethodDelete, fmt.Sprintf("http://%s:%d/ip/weave:expose/%s",
+		w.address, w.httpPort, addr.Addr()), nil)
+	return err
+}
+
+// sharedRules reports whether the rules of addr are used by an address of the
+// bridge or by the masquerade of ipRange. iptables stores the rules with the
+// subnet of the address, so hiding addr must keep them.
+func sharedRules(addr netip.Prefix, bridge []netip.Prefix, ipRange netip.Prefix) bool {
+	subnet := addr.Masked()
+	if subnet == ipRange {
+		return true
+	}
+	for _, other := range bridge {
+		if other.Masked() == subnet {
+			return true
+		}
+	}
+	return false
+}
+
+func removePrefix(prefixes []netip.Prefix, p netip.Prefix) []netip.Prefix {
+	kept := prefixes[:0:0]
+	for _, e := range prefixes {
+		if e != p {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// exposeRules are the expose rules of the WEAVE and WEAVE_EXPOSE chains by
+// subnet.
+type exposeRules struct {
+	masquerade map[netip.Prefix]int
+	accept     map[netip.Prefix]bool
+}
+
+func parseExposeState(output string) ([]netip.Prefix, exposeRules, error) {
+	rules := exposeRules{masquerade: make(map[netip.Prefix]int), accept: make(map[netip.Prefix]bool)}
+	var bridge []netip.Prefix
+	var section string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			section = line
+			continue
+		}
+		fields := strings.Fields(line)
+		switch section {
+		case "#addr":
+			for i := 0; i+1 < len(fields); i++ {
+				if fields[i] == "inet" {
+					prefix, err := netip.ParsePrefix(fields[i+1])
+					if err != nil {
+						return nil, rules, errors.Wrapf(err, "invalid weave bridge address %q", line)
+					}
+					bridge = append(bridge, prefix)
+				}
+			}
+		case "#nat", "#filter":
+			rule, ok := parseIptablesRule(fields)
+			if !ok {
+				continue
+			}
+			switch {
+			case section == "#nat" && rule.target == "MASQUERADE" && rule.src == rule.dst &&
+				rule.src.IsValid() && rule.srcNegated != rule.dstNegated:
+				rules.masquerade[rule.src]++
+			case section == "#filter" && rule.target == "ACCEPT" && rule.dst.IsValid() &&
+				!rule.dstNegated && !rule.src.IsValid():
+				rules.accept[rule.dst] = true
+			}
+		}
+	}
+	return bridge, rules, scanner.Err()
+}
+
+type iptablesRule struct {
+	src, dst               netip.Prefix
+	srcNegated, dstNegated bool
+	target                 string
+}
+
+// parseIptablesRule parses an append line of iptables -S with source,
+// destination and target only, e.g. -A WEAVE ! -s 10.32.0.0/12 -d 10.32.0.0/12 -j MASQUERADE
+func parseIptablesRule(fields []string) (iptablesRule, bool) {
+	var rule iptablesRule
+	if len(fields) < 2 || fields[0] != "-A" {
+		return rule, false
+	}
+	negated := false
+	for i := 2; i < len(fields); i++ {
+		switch fields[i] {
+		case "!":
+			negated = true
+			continue
+		case "-s", "-d":
+			if i+1 >= len(fields) {
+				return rule, false
+			}
+			prefix, err := netip.ParsePrefix(fields[i+1])
+			if err != nil {
+				return rule, false
+			}
+			if fields[i] == "-s" {
+				rule.src, rule.srcNegated = prefix, negated
+			} else {
+				rule.dst, rule.dstNegated = prefix, negated
+			}
+			i++
+		case "-j":
+			if i+1 >= len(fields) {
+				return rule, false
+			}
+			rule.target = fields[i+1]
+			i++
+		default:
+			// matches on anything else are not expose rules
+			return rule, false
+		}
+		negated = false
+	}
+	return rule, true
+}
+
+// exposedAddresses merges the expose state. The router may masquerade the
+// whole ip range with the same rules as expose, so rules of ipRange are
+// never stale.
+func exposedAddresses(owned, bridge []netip.Prefix, rules exposeRules, ipRange netip.Prefix) []ExposedAddress {
+	states := make(map[netip.Prefix]*ExposedAddress)
+	state := func(addr netip.Prefix) *ExposedAddress {
+		if e, ok := states[addr]; ok {
+			return e
+		}
+		e := &ExposedAddress{Address: addr}
+		states[addr] = e
+		return e
+	}
+	for _, addr := range owned {
+		state(addr).IPAM = true
+	}
+	for _, addr := range bridge {
+		state(addr).Bridge = true
+	}
+	usedSubnets := map[netip.Prefix]bool{ipRange: true}
+	for addr, e := range states {
+		subnet := addr.Masked()
+		e.MasqueradeRules = rules.masquerade[subnet]
+		e.Accept = rules.accept[subnet]
+		if e.Bridge {
+			usedSubnets[subnet] = true
+		}
+	}
+	// rules of subnets without an address on the bridge are stale
+	for subnet, n := range rules.masquerade {
+		if !usedSubnets[subnet] {
+			state(subnet).MasqueradeRules = n
+		}
+	}
+	for subnet := range rules.accept {
+		if !usedSubnets[subnet] {
+			state(subnet).Accept = true
+		}
+	}
+
+	list := make([]ExposedAddress, 0, len(states))
+	for _, e := range states {
+		switch {
+		case e.Bridge && !e.IPAM:
+			e.Problems = append(e.Problems, "address on the weave bridge is not owned by weave:expose")
+		case e.IPAM && !e.Bridge:
+			e.Problems = append(e.Problems, "address owned by weave:expose is not on the weave bridge")
+		case !e.IPAM && !e.Bridge:
+			e.Problems = append(e.Problems, "iptables rules without an exposed address")
+		}
+		if e.Bridge && !e.Accept {
+			e.Problems = append(e.Problems, "WEAVE_EXPOSE accept rule is missing")
+		}
+		if e.MasqueradeRules == 1 {
+			e.Problems = append(e.Problems, "one of the WEAVE masquerade rules is missing")
+		}
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Address.Addr() != list[j].Address.Addr() {
+			return list[i].Address.Addr().Less(list[j].Address.Addr())
+		}
+		return list[i].Address.Bits() < list[j].Address.Bits()
+	})
+	return list
+}
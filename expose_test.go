@@ -0,0 +1,197 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testExposeState = `#addr
+5: weave    inet 10.32.0.2/12 brd 10.47.255.255 scope global weave\       valid_lft forever preferred_lft forever
+5: weave    inet 10.44.0.1/24 scope global weave\       valid_lft forever preferred_lft forever
+#nat
+-N WEAVE
+-A WEAVE -m set --match-set weaver-no-masq-local dst -m comment --comment "Prevent SNAT" -j RETURN
+-A WEAVE -s 10.32.0.0/12 -d 224.0.0.0/4 -j RETURN
+-A WEAVE ! -s 10.32.0.0/12 -d 10.32.0.0/12 -j MASQUERADE
+-A WEAVE -s 10.32.0.0/12 ! -d 10.32.0.0/12 -j MASQUERADE
+-A WEAVE ! -s 10.50.0.0/24 -d 10.50.0.0/24 -j MASQUERADE
+#filter
+-N WEAVE_EXPOSE
+-A WEAVE_EXPOSE -d 10.32.0.0/12 -j ACCEPT
+-A WEAVE_EXPOSE -d 10.50.0.0/24 -j ACCEPT
+`
+
+func TestParseExposeState(t *testing.T) {
+	bridge, rules, err := parseExposeState(testExposeState)
+	require.NoError(t, err)
+	require.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.32.0.2/12"), netip.MustParsePrefix("10.44.0.1/24")}, bridge)
+	require.Equal(t, map[netip.Prefix]int{
+		netip.MustParsePrefix("10.32.0.0/12"): 2,
+		netip.MustParsePrefix("10.50.0.0/24"): 1,
+	}, rules.masquerade)
+	require.Equal(t, map[netip.Prefix]bool{
+		netip.MustParsePrefix("10.32.0.0/12"): true,
+		netip.MustParsePrefix("10.50.0.0/24"): true,
+	}, rules.accept)
+}
+
+func TestWeave_ListExposed(t *testing.T) {
+	var mu sync.Mutex
+	var hidden, calls []string
+	failHide := ""
+	mux := http.NewServeMux()
+	fakeWeaveExec(mux, func(cmd []string) (string, string, int) {
+		require.Equal(t, []string{"sh", "-c"}, cmd[:2])
+		if strings.Contains(cmd[2], "#addr") {
+			return testExposeState, "", 0
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		hidden = append(hidden, hiddenAddress(cmd[2]))
+		if failHide != "" && strings.Contains(cmd[2], failHide) {
+			return "", "RTNETLINK answers: Operation not permitted\n", 1
+		}
+		return "", "", 0
+	})
+	mux.HandleFunc("/ip/weave:expose", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "10.32.0.2/12 10.32.0.9/12")
+	})
+	mux.HandleFunc("/ip/", func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+	})
+	mux.HandleFunc("/expose/", func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+	})
+	w := newFakeDockerRouter(t, mux)
+	w.ipRange = "10.32.0.0/12"
+
+	exposed, err := w.ListExposed(context.Background())
+	require.NoError(t, err)
+	require.Len(t, exposed, 4)
+
+	require.Equal(t, "10.32.0.2/12", exposed[0].Address.String())
+	require.True(t, exposed[0].Consistent(), exposed[0].Problems)
+	require.Equal(t, 2, exposed[0].MasqueradeRules)
+
+	require.Equal(t, "10.32.0.9/12", exposed[1].Address.String())
+	require.Equal(t, []string{"address owned by weave:expose is not on the weave bridge"}, exposed[1].Problems)
+
+	require.Equal(t, "10.44.0.1/24", exposed[2].Address.String())
+	require.Equal(t, []string{
+		"address on the weave bridge is not owned by weave:expose",
+		"WEAVE_EXPOSE accept rule is missing",
+	}, exposed[2].Problems)
+
+	require.Equal(t, "10.50.0.0/24", exposed[3].Address.String())
+	require.Equal(t, []string{
+		"iptables rules without an exposed address",
+		"one of the WEAVE masquerade rules is missing",
+	}, exposed[3].Problems)
+
+	repaired, err := w.RepairExposed(context.Background(), RepairExpose)
+	require.NoError(t, err)
+	require.Len(t, repaired, 3)
+	require.Equal(t, []string{
+		"POST /expose/10.32.0.9/12",
+		"PUT /ip/weave:expose/10.44.0.1/24",
+		"POST /expose/10.44.0.1/24?skipNAT=true",
+	}, calls)
+	require.Equal(t, []string{"10.50.0.0/24 with rules"}, hidden)
+
+	// the rules of 10.32.0.9/12 are the rules of 10.32.0.2/12 as well, and a
+	// failed removal is an error
+	calls, hidden, failHide = nil, nil, "10.50.0.0/24"
+	_, err = w.RepairExposed(context.Background(), RepairHide)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Operation not permitted")
+	require.Equal(t, []string{"10.32.0.9/12", "10.44.0.1/24 with rules", "10.50.0.0/24 with rules"}, hidden)
+	require.Equal(t, []string{"DELETE /ip/weave:expose/10.32.0.9"}, calls)
+}
+
+func TestWeave_HideSharedRules(t *testing.T) {
+	var mu sync.Mutex
+	var hidden, calls []string
+	mux := http.NewServeMux()
+	fakeWeaveExec(mux, func(cmd []string) (string, string, int) {
+		if strings.Contains(cmd[2], "#addr") {
+			return testExposeState, "", 0
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		hidden = append(hidden, hiddenAddress(cmd[2]))
+		return "", "", 0
+	})
+	mux.HandleFunc("/ip/weave:expose", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "10.32.0.2/12 10.32.0.9/12 10.44.0.1/24")
+	})
+	mux.HandleFunc("/ip/", func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+	})
+	w := newFakeDockerRouter(t, mux)
+	w.ipRange = "10.32.0.0/12"
+
+	result, err := w.Hide()
+	require.NoError(t, err)
+	require.Len(t, result.Addresses, 3)
+	// the router masquerades the ip range with the rules of 10.32.0.0/12
+	require.Equal(t, []string{"10.32.0.2/12", "10.32.0.9/12", "10.44.0.1/24 with rules"}, hidden)
+	require.Equal(t, []string{
+		"DELETE /ip/weave:expose/10.32.0.2",
+		"DELETE /ip/weave:expose/10.32.0.9",
+		"DELETE /ip/weave:expose/10.44.0.1",
+	}, calls)
+}
+
+// hiddenAddress returns the address a hide command removes, with its rules
+// when they are removed as well.
+func hiddenAddress(cmd string) string {
+	var addr string
+	for _, line := range strings.Split(cmd, "\n") {
+		if strings.HasPrefix(line, "\tip addr del") {
+			addr = strings.Fields(line)[5]
+		}
+	}
+	if strings.Contains(cmd, "iptables -w -t $table -D") {
+		return addr + " with rules"
+	}
+	return addr
+}
+
+func TestWeave_ExposeMasquerade(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ipinfo/tracker", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "ring")
+	})
+	mux.HandleFunc("/ip/weave:expose", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "10.32.0.2/12")
+	})
+	mux.HandleFunc("/expose/", func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+	})
+	w := newFakeRouter(t, mux)
+
+	_, err := w.Expose("", false)
+	require.NoError(t, err)
+	_, err = w.Expose("", true)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"POST /expose/10.32.0.2/12",
+		"POST /expose/10.32.0.2/12?skipNAT=true",
+	}, calls)
+}
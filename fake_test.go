@@ -0,0 +1,81 @@
+package go_weave_api
+
+import (
+	"encoding/json"
+	"fmt"
+	docker "github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newFakeDockerRouter returns a Weave whose docker daemon and router are both
+// served by mux.
+func newFakeDockerRouter(t *testing.T, mux *http.ServeMux) *Weave {
+	t.Helper()
+	w := newFakeRouter(t, mux)
+	cli, err := docker.NewClientWithOpts(docker.WithHost(fmt.Sprintf("tcp://%s:%d", w.address, w.httpPort)),
+		docker.WithVersion("1.41"))
+	require.NoError(t, err)
+	t.Cleanup(func() { cli.Close() })
+	w.dockerCli = cli
+	w.dns.weave = w
+	return w
+}
+
+// fakeWeaveExec serves the docker calls of the weaveexec containers, exec
+// returns the stdout, the stderr and the exit code of a command. The returned
+// func returns the create request of the container with a name.
+func fakeWeaveExec(mux *http.ServeMux, exec func(cmd []string) (string, string, int)) func(name string) []byte {
+	type output struct {
+		stdout, stderr string
+		exitCode       int
+	}
+	var mu sync.Mutex
+	outputs := make(map[string]output)
+	named := make(map[string][]byte)
+	mux.HandleFunc("/v1.41/containers/create", func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var config struct{ Entrypoint []string }
+		_ = json.Unmarshal(body, &config)
+		mu.Lock()
+		id := fmt.Sprintf("exec%d", len(outputs))
+		if name := r.URL.Query().Get("name"); name != "" {
+			named[name] = body
+		}
+		stdout, stderr, exitCode := exec(config.Entrypoint)
+		outputs[id] = output{stdout: stdout, stderr: stderr, exitCode: exitCode}
+		mu.Unlock()
+		fmt.Fprintf(rw, `{"Id":%q}`, id)
+	})
+	mux.HandleFunc("/v1.41/containers/", func(rw http.ResponseWriter, r *http.Request) {
+		id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1.41/containers/"), "/")
+		mu.Lock()
+		out := outputs[id]
+		mu.Unlock()
+		switch action {
+		case "json":
+			fmt.Fprintf(rw, `{"Id":%q}`, id)
+		case "wait":
+			fmt.Fprintf(rw, `{"StatusCode":%d}`, out.exitCode)
+		case "logs":
+			if out.stdout != "" {
+				_, _ = stdcopy.NewStdWriter(rw, stdcopy.Stdout).Write([]byte(out.stdout))
+			}
+			if out.stderr != "" {
+				_, _ = stdcopy.NewStdWriter(rw, stdcopy.Stderr).Write([]byte(out.stderr))
+			}
+		default:
+			rw.WriteHeader(http.StatusNoContent)
+		}
+	})
+	return func(name string) []byte {
+		mu.Lock()
+		defer mu.Unlock()
+		return named[name]
+	}
+}
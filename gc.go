@@ -0,0 +1,172 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	"net/http"
+	"time"
+)
+
+type GCOptions struct {
+	// DryRun only reports the orphans
+	DryRun bool
+	// ExcludeContainers are never collected, full or short ids
+	ExcludeContainers []string
+	// Containers are checked for ipam allocations in addition to the
+	// containers found in the dns status. An allocation of a container
+	// without a dns entry is only found with Containers, a removed container
+	// without dns entry needs its full id.
+	Containers []string
+}
+
+// GCReport lists the orphans found by GC, they are removed unless DryRun is set.
+type GCReport struct {
+	DryRun    bool
+	OrphanDNS []DNSStatus
+	// OrphanAddresses are the CIDRs allocated to containers which do not
+	// exist, by full container id
+	OrphanAddresses map[string][]string
+}
+
+// GC finds the dns entries and ipam allocations of containers which do not
+// exist on the node's docker daemon anymore, e.g. because they died without
+// Detach or were registered without check-alive. Only the dns entries whose
+// origin is the local peer are considered, the entries of other hosts and
+// the external entries are never touched. ipam can not list the containers
+// holding addresses, so the allocations are only checked for the containers
+// with a dns entry and for opts.Containers, an orphan without a dns entry is
+// only found when it is passed in opts.Containers.
+// The dns entries and allocations are read before the containers are listed,
+// so a container started in between is not collected.
+func (w *Weave) GC(ctx context.Context, opts GCOptions) (*GCReport, error) {
+	excluded := make(map[string]struct{}, len(opts.ExcludeContainers))
+	for _, id := range opts.ExcludeContainers {
+		excluded[shortContainerId(id)] = struct{}{}
+	}
+	isExcluded := func(containerId string) bool {
+		_, ok := excluded[shortContainerId(containerId)]
+		return ok
+	}
+
+	// the dns status shortens the container ids, the router keeps the names
+	// and addresses under the full ids of the report
+	ids, err := w.reportContainerIds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fullIds := make(map[string]string)
+	resolve := func(containerId string) (string, error) {
+		id, err := w.resolveContainerId(ids, containerId)
+		if err != nil {
+			return "", err
+		}
+		fullIds[containerId] = id
+		return id, nil
+	}
+
+	var entries []DNSStatus
+	candidates := make(map[string]struct{})
+	if !w.dns.Disabled {
+		localPeer, err := w.localPeerName(ctx)
+		if err != nil {
+			return nil, err
+		}
+		status, err := w.status(ctx, "dns")
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range NewDNSIndex(status.DNS, w.dns.Search).Find(DNSQuery{Origin: localPeer, Kind: DNSKindContainer}) {
+			if !isExcluded(entry.ContainerId) {
+				id, err := resolve(entry.ContainerId)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, entry)
+				candidates[id] = struct{}{}
+			}
+		}
+	}
+	for _, containerId := range opts.Containers {
+		if !isExcluded(containerId) {
+			id, err := resolve(containerId)
+			if err != nil {
+				return nil, err
+			}
+			candidates[id] = struct{}{}
+		}
+	}
+	allocations := make(map[string][]string, len(candidates))
+	for id := range candidates {
+		addrs, err := w.containerAddrs(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) > 0 {
+			allocations[id] = addrs
+		}
+	}
+
+	containers, err := w.dockerCli.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	alive := make(map[string]struct{}, len(containers))
+	for _, ctr := range containers {
+		alive[shortContainerId(ctr.ID)] = struct{}{}
+	}
+	isOrphan := func(containerId string) bool {
+		_, ok := alive[shortContainerId(containerId)]
+		return !ok
+	}
+
+	report := &GCReport{DryRun: opts.DryRun, OrphanAddresses: make(map[string][]string)}
+	for _, entry := range entries {
+		if isOrphan(entry.ContainerId) {
+			report.OrphanDNS = append(report.OrphanDNS, entry)
+		}
+	}
+	for id, addrs := range allocations {
+		if isOrphan(id) {
+			report.OrphanAddresses[id] = addrs
+		}
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+	for _, entry := range report.OrphanDNS {
+		if err := w.dns.removeWeaveDNS(fullIds[entry.ContainerId], entry.Address, entry.Hostname, false); err != nil {
+			return report, errors.Wrapf(err, "remove dns entry %s of container %s", entry.Hostname, entry.ContainerId)
+		}
+	}
+	for id := range report.OrphanAddresses {
+		if _, err := callWeaveContext(ctx, http.MethodDelete, fmt.Sprintf("http://%s:%d/ip/%s",
+			w.address, w.httpPort, id), nil); err != nil {
+			return report, errors.Wrapf(err, "release addresses of container %s", id)
+		}
+	}
+	return report, nil
+}
+
+// GCLoop runs GC every interval until ctx is done, handler is called with
+// the result of every run.
+func (w *Weave) GCLoop(ctx context.Context, interval time.Duration, opts GCOptions, handler func(*GCReport, error)) error {
+	if interval <= 0 {
+		return errors.New("gc interval must be positive")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		report, err := w.GC(ctx, opts)
+		if handler != nil {
+			handler(report, err)
+		}
+	}
+}
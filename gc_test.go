@@ -0,0 +1,153 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testFullId pads a short container id to a full one.
+func testFullId(short string) string {
+	return short + strings.Repeat("0", fullContainerIdLen-len(short))
+}
+
+// testReport is a router report with dns entries of the containers.
+func testReport(shorts ...string) string {
+	var entries []string
+	for _, short := range shorts {
+		entries = append(entries, fmt.Sprintf(`{"ContainerID":%q}`, testFullId(short)))
+	}
+	return fmt.Sprintf(`{"DNS":{"Entries":[%s]}}`, strings.Join(entries, ","))
+}
+
+func TestWeave_GC(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	record := func(r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		mu.Lock()
+		calls = append(calls, fmt.Sprintf("%s %s %s", r.Method, r.URL.Path, r.Form.Get("fqdn")))
+		mu.Unlock()
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.41/containers/json", func(rw http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "1", r.URL.Query().Get("all"))
+		fmt.Fprintf(rw, `[{"Id":%q}]`, testFullId("90440c9f28af"))
+	})
+	mux.HandleFunc("/report", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, testReport("90440c9f28af", "8a7b6c5d4e3f", "1a2b3c4d5e6f", "4d1b2c3e4f5a"))
+	})
+	mux.HandleFunc("/status", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, testOverviewStatus)
+	})
+	mux.HandleFunc("/status/dns", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `api          180.101.49.11   weave:extern 5e:a4:e5:b8:d1:b6
+box          10.32.0.1       90440c9f28af 5e:a4:e5:b8:d1:b6
+gone         10.32.0.2       8a7b6c5d4e3f 5e:a4:e5:b8:d1:b6
+kept         10.32.0.3       1a2b3c4d5e6f 5e:a4:e5:b8:d1:b6
+remote       10.40.0.1       4d1b2c3e4f5a 3a:8c:e4:ba:50:ee
+`)
+	})
+	mux.HandleFunc("/ip/", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			record(r)
+			return
+		}
+		// the router only knows the full ids
+		switch r.URL.Path {
+		case "/ip/" + testFullId("8a7b6c5d4e3f"):
+			fmt.Fprint(rw, "10.32.0.2/12")
+		case "/ip/" + testFullId("c0ffee000000"):
+			fmt.Fprint(rw, "10.32.0.4/12")
+		default:
+			http.NotFound(rw, r)
+		}
+	})
+	mux.HandleFunc("/name/", func(rw http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/name/"+testFullId("8a7b6c5d4e3f")+"/") {
+			http.NotFound(rw, r)
+			return
+		}
+		record(r)
+	})
+	w := newFakeDockerRouter(t, mux)
+
+	opts := GCOptions{DryRun: true, ExcludeContainers: []string{"1a2b3c4d5e6f"}, Containers: []string{testFullId("c0ffee000000"), "90440c9f28af"}}
+	report, err := w.GC(context.Background(), opts)
+	require.NoError(t, err)
+	require.Len(t, report.OrphanDNS, 1)
+	require.Equal(t, "gone", report.OrphanDNS[0].Hostname)
+	require.Equal(t, map[string][]string{
+		testFullId("8a7b6c5d4e3f"): {"10.32.0.2/12"},
+		testFullId("c0ffee000000"): {"10.32.0.4/12"},
+	}, report.OrphanAddresses)
+	require.Empty(t, calls)
+
+	opts.DryRun = false
+	_, err = w.GC(context.Background(), opts)
+	require.NoError(t, err)
+	sort.Strings(calls)
+	require.Equal(t, []string{
+		"DELETE /ip/" + testFullId("8a7b6c5d4e3f") + " ",
+		"DELETE /ip/" + testFullId("c0ffee000000") + " ",
+		"DELETE /name/" + testFullId("8a7b6c5d4e3f") + "/10.32.0.2 gone.weave.local.",
+	}, calls)
+}
+
+func TestWeave_GCUnknownContainer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/report", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, testReport())
+	})
+	mux.HandleFunc("/ip/", func(rw http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+	})
+	w := newFakeDockerRouter(t, mux)
+	w.dns.Disabled = true
+
+	_, err := w.GC(context.Background(), GCOptions{Containers: []string{"c0ffee000000"}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "c0ffee000000")
+}
+
+func TestWeave_GCStartedContainer(t *testing.T) {
+	var mu sync.Mutex
+	started := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, testOverviewStatus)
+	})
+	mux.HandleFunc("/status/dns", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "late         10.32.0.5       7e57ab1e0000 5e:a4:e5:b8:d1:b6\n")
+	})
+	mux.HandleFunc("/report", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, testReport("7e57ab1e0000"))
+	})
+	mux.HandleFunc("/ip/", func(rw http.ResponseWriter, r *http.Request) {
+		// the container starts after its state is read
+		mu.Lock()
+		started = true
+		mu.Unlock()
+		fmt.Fprint(rw, "10.32.0.5/12")
+	})
+	mux.HandleFunc("/v1.41/containers/json", func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if started {
+			fmt.Fprintf(rw, `[{"Id":%q}]`, testFullId("7e57ab1e0000"))
+			return
+		}
+		fmt.Fprint(rw, `[]`)
+	})
+	w := newFakeDockerRouter(t, mux)
+
+	report, err := w.GC(context.Background(), GCOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Empty(t, report.OrphanDNS)
+	require.Empty(t, report.OrphanAddresses)
+}
@@ -0,0 +1,108 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// Finding is a problem found in the status of a weave router.
+type Finding struct {
+	Severity Severity
+	// Check is the name of the check which produced the finding
+	Check string
+	// Subject is the connection, peer or service the finding is about
+	Subject string
+	Message string
+}
+
+func (f Finding) String() string {
+	if f.Subject == "" {
+		return fmt.Sprintf("[%s] %s: %s", f.Severity, f.Check, f.Message)
+	}
+	return fmt.Sprintf("[%s] %s %s: %s", f.Severity, f.Check, f.Subject, f.Message)
+}
+
+// Health queries the status of the weave router and evaluates it, the findings
+// are sorted from the most to the least severe. An empty result means healthy.
+func (w *Weave) Health(ctx context.Context) ([]Finding, error) {
+	status, err := w.fullStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return w.evaluateHealth(status), nil
+}
+
+func (w *Weave) evaluateHealth(status *Status) []Finding {
+	var findings []Finding
+
+	for _, conn := range status.Connections {
+		switch conn.State {
+		case "failed":
+			findings = append(findings, Finding{SeverityCritical, "connection", conn.Address,
+				fmt.Sprintf("connection failed: %s", conn.FailureReason)})
+		case "retrying":
+			findings = append(findings, Finding{SeverityWarning, "connection", conn.Address,
+				fmt.Sprintf("connection retrying: %s", conn.FailureReason)})
+		case "established":
+			if !w.disableFastDP && conn.Datapath == "sleeve" {
+				findings = append(findings, Finding{SeverityWarning, "datapath", conn.Address,
+					"connection fell back to sleeve, fast datapath is not in use"})
+			}
+		}
+	}
+
+	for _, peer := range status.IPAM.Peers {
+		if peer.Unreachable && peer.Addresses > 0 {
+			findings = append(findings, Finding{SeverityCritical, "ipam", peer.NodeId,
+				fmt.Sprintf("unreachable peer owns %d IPs (%.1f%% of total), remove it with rmpeer if it is gone for good",
+					peer.Addresses, peer.Percentage)})
+		}
+	}
+
+	if status.Overview != nil {
+		overview := status.Overview
+		if overview.IPAM.Status != "" && overview.IPAM.Status != "ready" {
+			findings = append(findings, Finding{SeverityWarning, "ipam", "",
+				fmt.Sprintf("ipam is not ready: %s", overview.IPAM.Status)})
+		}
+		if overview.Router.Encryption == "disabled" && len(status.Peers) > 1 {
+			findings = append(findings, Finding{SeverityWarning, "encryption", "",
+				fmt.Sprintf("encryption is disabled while %d peers are connected", len(status.Peers))})
+		}
+		if overview.DNS.Domain == "" {
+			findings = append(findings, Finding{SeverityInfo, "dns", "",
+				"weaveDNS is disabled on this node"})
+		}
+		// the default version is no expectation, only WithVersion is compared
+		if w.versionSet && overview.Version != "" && overview.Version != w.version {
+			findings = append(findings, Finding{SeverityWarning, "version", "",
+				fmt.Sprintf("router runs version %s, but version %s is configured", overview.Version, w.version)})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity > findings[j].Severity
+	})
+	return findings
+}
@@ -0,0 +1,53 @@
+package go_weave_api
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseIPAMStatus(t *testing.T) {
+	data := `ce:31:e0:06:45:1a(host1)     349526 IPs (33.3% of total) (1 active)
+ca:3d:46:8d:0b:ea(host2)     349525 IPs (33.3% of total) 
+f6:07:80:14:67:d3(host3)     349525 IPs (33.3% of total) - unreachable!
+`
+	status := parseIPAMStatus([]byte(data))
+	require.Len(t, status.Peers, 3)
+	require.Equal(t, IPAMPeer{NodeId: "ce:31:e0:06:45:1a(host1)", Addresses: 349526, Percentage: 33.3, Active: 1},
+		status.Peers[0])
+	require.False(t, status.Peers[1].Unreachable)
+	require.True(t, status.Peers[2].Unreachable)
+}
+
+func TestWeave_EvaluateHealth(t *testing.T) {
+	w := &Weave{version: "2.8.1", versionSet: true}
+	status := &Status{
+		Overview: parseOverviewStatus([]byte(testOverviewStatus)),
+		Peers:    []PeerStatus{{NodeId: "5e:a4:e5:b8:d1:b6(host1)"}, {NodeId: "3a:8c:e4:ba:50:ee(host2)"}},
+		Connections: parseConnectionStatus([]byte(`-> 192.168.0.112:6783     established unencrypted sleeve 3a:8c:e4:ba:50:ee(host2) mtu=1376
+-> 192.168.0.113:6783     failed      dial tcp 192.168.0.113:6783: connect: connection refused, retry: 2022-09-01 10:00:00
+`)),
+		IPAM: *parseIPAMStatus([]byte("f6:07:80:14:67:d3(host3)     349525 IPs (33.3% of total) - unreachable!\n")),
+	}
+	status.Overview.Version = "2.8.0"
+
+	findings := w.evaluateHealth(status)
+	checks := make(map[string]Severity)
+	for _, finding := range findings {
+		checks[finding.Check+" "+finding.Subject] = finding.Severity
+	}
+	require.Len(t, findings, 5)
+	require.Equal(t, SeverityCritical, findings[0].Severity)
+	require.Equal(t, SeverityCritical, checks["connection 192.168.0.113:6783"])
+	require.Equal(t, SeverityCritical, checks["ipam f6:07:80:14:67:d3(host3)"])
+	require.Equal(t, SeverityWarning, checks["datapath 192.168.0.112:6783"])
+	require.Equal(t, SeverityWarning, checks["encryption "])
+	require.Equal(t, SeverityWarning, checks["version "])
+
+	// sleeve is expected when fast datapath is disabled
+	w.disableFastDP = true
+	require.Len(t, w.evaluateHealth(status), 4)
+
+	// the default version is not compared
+	w.versionSet = false
+	require.Len(t, w.evaluateHealth(status), 3)
+}
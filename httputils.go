@@ -1,14 +1,35 @@
 package go_weave_api
 
 import (
+	"context"
+	"fmt"
 	"github.com/pkg/errors"
 	"io"
 	"net/http"
 )
 
+// httpStatusError is returned when the weave node answers with an unexpected status code
+type httpStatusError struct {
+	code int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("http call with status code %d", e.code)
+}
+
+func isHTTPNotFound(err error) bool {
+	var statusErr *httpStatusError
+	return errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound
+}
+
 // callWeave sends a http request to weave node
 func callWeave(method, url string, body io.Reader) ([]byte, error) {
-	req, err := http.NewRequest(method, url, body)
+	return callWeaveContext(context.Background(), method, url, body)
+}
+
+// callWeaveContext sends a http request to weave node, the request is canceled with ctx
+func callWeaveContext(ctx context.Context, method, url string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
@@ -23,7 +44,7 @@ func callWeave(method, url string, body io.Reader) ([]byte, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return nil, errors.Errorf("http call with status code %d", resp.StatusCode)
+		return nil, &httpStatusError{code: resp.StatusCode}
 	}
 
 	data, err := io.ReadAll(resp.Body)
@@ -0,0 +1,127 @@
+package go_weave_api
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+type ipAllocMode int
+
+const (
+	ipAllocConsensus ipAllocMode = iota
+	ipAllocSeed
+	ipAllocObserver
+)
+
+// ipAllocInit is the --ipalloc-init mode of the router, it decides how the
+// first peers split the ip range between them.
+type ipAllocInit struct {
+	mode      ipAllocMode
+	consensus int
+	seed      []string
+}
+
+func (i ipAllocInit) String() string {
+	switch i.mode {
+	case ipAllocSeed:
+		return "seed=" + strings.Join(i.seed, ",")
+	case ipAllocObserver:
+		return "observer"
+	}
+	return "consensus=" + strconv.Itoa(i.consensus)
+}
+
+// validateIPAllocInit checks the ipalloc-init options against the peers and
+// the names of the node before the router is launched.
+func (w *Weave) validateIPAllocInit() error {
+	if len(w.ipAllocInits) == 0 {
+		return nil
+	}
+	if len(w.ipAllocInits) > 1 {
+		return errors.New("only one of the consensus, seed and observer ipalloc-init options may be set")
+	}
+	init := w.ipAllocInits[0]
+	switch init.mode {
+	case ipAllocConsensus:
+		if init.consensus < 1 {
+			return errors.Errorf("ipalloc-init consensus needs at least one peer, got %d", init.consensus)
+		}
+		if init.consensus > 1 && len(w.peers) == 0 {
+			return errors.Errorf("ipalloc-init consensus=%d needs the addresses of the other peers", init.consensus)
+		}
+		// the node itself and every peer it connects to take part in the consensus
+		if len(w.peers)+1 > init.consensus {
+			return errors.Errorf("ipalloc-init consensus=%d is less than the %d peers the node knows", init.consensus, len(w.peers)+1)
+		}
+	case ipAllocSeed:
+		if len(init.seed) == 0 {
+			return errors.New("ipalloc-init seed needs at least one peer name")
+		}
+		seen := make(map[string]struct{}, len(init.seed))
+		for _, name := range init.seed {
+			normalized, ok := normalizePeerName(name)
+			if !ok {
+				if name == w.nickname {
+					return errors.Errorf("ipalloc-init seed %s is the nickname of the node, seeds are peer names, see WithName", name)
+				}
+				return errors.Errorf("ipalloc-init seed %s is not a peer name like 00:00:00:00:00:01 or ::1", name)
+			}
+			if _, ok := seen[normalized]; ok {
+				return errors.Errorf("ipalloc-init seed %s is listed twice", name)
+			}
+			seen[normalized] = struct{}{}
+		}
+		if len(init.seed) > 1 && len(w.peers) == 0 {
+			return errors.New("ipalloc-init seed with several peers needs the addresses of the other peers")
+		}
+	case ipAllocObserver:
+		if len(w.peers) == 0 {
+			return errors.New("ipalloc-init observer needs peers to get address space from")
+		}
+	}
+	return nil
+}
+
+// normalizePeerName returns the full form of a weave peer name, a mac
+// address of six hex groups. Like weave, a name may shorten zero groups with
+// one :: between one to four groups, e.g. ::1 or 1::2.
+func normalizePeerName(name string) (string, bool) {
+	name = strings.ToLower(name)
+	var groups []string
+	if head, tail, ok := strings.Cut(name, "::"); ok {
+		left, right := splitPeerGroups(head), splitPeerGroups(tail)
+		if n := len(left) + len(right); n < 1 || n > 4 {
+			return "", false
+		}
+		groups = append(groups, left...)
+		for i := len(left) + len(right); i < 6; i++ {
+			groups = append(groups, "0")
+		}
+		groups = append(groups, right...)
+	} else {
+		groups = strings.Split(name, ":")
+		if len(groups) != 6 {
+			return "", false
+		}
+	}
+	for i, group := range groups {
+		if len(group) < 1 || len(group) > 2 {
+			return "", false
+		}
+		for j := 0; j < len(group); j++ {
+			if !(group[j] >= '0' && group[j] <= '9' || group[j] >= 'a' && group[j] <= 'f') {
+				return "", false
+			}
+		}
+		groups[i] = strings.Repeat("0", 2-len(group)) + group
+	}
+	return strings.Join(groups, ":"), true
+}
+
+func splitPeerGroups(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ":")
+}
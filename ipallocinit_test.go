@@ -0,0 +1,80 @@
+package go_weave_api
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestWeave_validateIPAllocInit(t *testing.T) {
+	newWeave := func(opts ...Option) *Weave {
+		w := &Weave{nickname: "host1", dns: &DNSServer{}}
+		for _, opt := range opts {
+			opt(w)
+		}
+		return w
+	}
+
+	valid := []*Weave{
+		newWeave(),
+		newWeave(WithIPAllocConsensus(1)),
+		newWeave(WithIPAllocConsensus(3), WithPeers("192.168.0.2", "192.168.0.3")),
+		newWeave(WithIPAllocSeed("::1")),
+		newWeave(WithIPAllocSeed("::1", "00:00:00:00:00:02"), WithPeers("192.168.0.2")),
+		newWeave(WithIPAllocObserver(), WithPeers("192.168.0.2"), NoDefaultIPAlloc()),
+	}
+	for _, w := range valid {
+		require.NoError(t, w.validateIPAllocInit(), w.ipAllocInits)
+	}
+
+	invalid := []*Weave{
+		newWeave(WithIPAllocConsensus(0)),
+		newWeave(WithIPAllocConsensus(3)),
+		newWeave(WithIPAllocConsensus(2), WithPeers("192.168.0.2", "192.168.0.3")),
+		newWeave(WithIPAllocSeed()),
+		newWeave(WithIPAllocSeed("host1")),
+		newWeave(WithIPAllocSeed("::1", "::01"), WithPeers("192.168.0.2")),
+		newWeave(WithIPAllocSeed("::1", "::2")),
+		newWeave(WithIPAllocObserver()),
+		newWeave(WithIPAllocObserver(), WithIPAllocConsensus(2), WithPeers("192.168.0.2")),
+	}
+	for _, w := range invalid {
+		require.Error(t, w.validateIPAllocInit(), w.ipAllocInits)
+	}
+
+	require.Equal(t, "seed=::1,::2", ipAllocInit{mode: ipAllocSeed, seed: []string{"::1", "::2"}}.String())
+	require.Equal(t, "consensus=3", ipAllocInit{mode: ipAllocConsensus, consensus: 3}.String())
+}
+
+func TestNormalizePeerName(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want string
+	}{
+		{"5E:A4:E5:B8:D1:B6", "5e:a4:e5:b8:d1:b6"},
+		{"5e:a4:e5:b8:d1:6", "5e:a4:e5:b8:d1:06"},
+		{"::1", "00:00:00:00:00:01"},
+		{"::01", "00:00:00:00:00:01"},
+		{"1::2", "01:00:00:00:00:02"},
+		{"1::", "01:00:00:00:00:00"},
+		{"a:b::c:d", "0a:0b:00:00:0c:0d"},
+		{"::c:d:e:f", "00:00:0c:0d:0e:0f"},
+		{"a:b:c:d::", "0a:0b:0c:0d:00:00"},
+		// invalid
+		{"host1", ""},
+		{":", ""},
+		{"::", ""},
+		{"1:2", ""},
+		{"1:2:3:4:5", ""},
+		{"1:2:3:4:5:6:7", ""},
+		{"1:2:3:4:5::", ""},
+		{"1::2::3", ""},
+		{"1:::2", ""},
+		{"1:2:3:4:5:", ""},
+		{"::100", ""},
+		{"::g1", ""},
+	} {
+		got, ok := normalizePeerName(tt.name)
+		require.Equal(t, tt.want != "", ok, tt.name)
+		require.Equal(t, tt.want, got, tt.name)
+	}
+}
@@ -0,0 +1,119 @@
+package go_weave_api
+
+import (
+	"context"
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// DefaultIPAMConcurrency is the number of parallel ipam lookups of
+// ListContainerAddresses when no concurrency is given.
+const DefaultIPAMConcurrency = 8
+
+// ContainerAddresses are the addresses ipam has allocated to a container,
+// Name is empty for weave:expose.
+type ContainerAddresses struct {
+	ContainerId string
+	Name        string
+	Addresses   []netip.Prefix
+}
+
+// ContainerAddresses returns the addresses ipam has allocated to the
+// container, or to the host with weave:expose. A container without
+// addresses returns no error.
+func (w *Weave) ContainerAddresses(ctx context.Context, containerId string) ([]netip.Prefix, error) {
+	addrs, err := w.containerAddrs(ctx, containerId)
+	if err != nil {
+		return nil, err
+	}
+	prefixes, err := parsePrefixes(strings.Join(addrs, " "))
+	if err != nil {
+		return nil, errors.Wrapf(err, "ipam returned an invalid address for %s", containerId)
+	}
+	return prefixes, nil
+}
+
+// ListContainerAddresses looks up the addresses of all containers of the
+// node's docker daemon and of weave:expose, at most concurrency lookups run
+// in parallel. Containers without addresses are left out.
+func (w *Weave) ListContainerAddresses(ctx context.Context, concurrency int) ([]ContainerAddresses, error) {
+	containers, err := w.dockerCli.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]ContainerAddresses, 0, len(containers)+1)
+	for _, ctr := range containers {
+		var name string
+		if len(ctr.Names) > 0 {
+			name = strings.TrimPrefix(ctr.Names[0], "/")
+		}
+		results = append(results, ContainerAddresses{ContainerId: ctr.ID, Name: name})
+	}
+	results = append(results, ContainerAddresses{ContainerId: "weave:expose"})
+
+	errs := make([]error, len(results))
+	runConcurrent(concurrency, len(results), func(i int) {
+		results[i].Addresses, errs[i] = w.ContainerAddresses(ctx, results[i].ContainerId)
+	})
+	for i, err := range errs {
+		if err != nil {
+			return nil, errors.Wrapf(err, "lookup addresses of %s", results[i].ContainerId)
+		}
+	}
+
+	list := results[:0]
+	for _, result := range results {
+		if len(result.Addresses) > 0 {
+			list = append(list, result)
+		}
+	}
+	return list, nil
+}
+
+// SubnetAddresses returns the containers holding addresses in subnet, with
+// only their addresses in subnet.
+func (w *Weave) SubnetAddresses(ctx context.Context, subnet netip.Prefix) ([]ContainerAddresses, error) {
+	all, err := w.ListContainerAddresses(ctx, DefaultIPAMConcurrency)
+	if err != nil {
+		return nil, err
+	}
+	var list []ContainerAddresses
+	for _, ctr := range all {
+		var inSubnet []netip.Prefix
+		for _, prefix := range ctr.Addresses {
+			if subnet.Contains(prefix.Addr()) {
+				inSubnet = append(inSubnet, prefix)
+			}
+		}
+		if len(inSubnet) > 0 {
+			ctr.Addresses = inSubnet
+			list = append(list, ctr)
+		}
+	}
+	return list, nil
+}
+
+// runConcurrent calls fn for 0..count-1 with at most concurrency calls in
+// parallel, DefaultIPAMConcurrency when concurrency is not positive.
+func runConcurrent(concurrency, count int, fn func(i int)) {
+	if concurrency <= 0 {
+		concurrency = DefaultIPAMConcurrency
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,61 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWeave_ListContainerAddresses(t *testing.T) {
+	var inFlight, maxInFlight int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.41/containers/json", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `[{"Id":"90440c9f28af","Names":["/web"]},{"Id":"4d1b2c3e4f5a","Names":["/db"]},{"Id":"77aa00bb11cc","Names":["/idle"]}]`)
+	})
+	addrs := map[string]string{
+		"/ip/90440c9f28af": "10.32.0.1/12",
+		"/ip/4d1b2c3e4f5a": "10.32.0.2/12 10.44.0.3/24",
+		"/ip/weave:expose": "10.44.0.1/24",
+	}
+	mux.HandleFunc("/ip/", func(rw http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		addr, ok := addrs[r.URL.Path]
+		if !ok {
+			http.NotFound(rw, r)
+			return
+		}
+		fmt.Fprint(rw, addr)
+	})
+	w := newFakeDockerRouter(t, mux)
+
+	list, err := w.ListContainerAddresses(context.Background(), 2)
+	require.NoError(t, err)
+	require.LessOrEqual(t, maxInFlight, int32(2))
+	require.Equal(t, []ContainerAddresses{
+		{ContainerId: "90440c9f28af", Name: "web", Addresses: []netip.Prefix{netip.MustParsePrefix("10.32.0.1/12")}},
+		{ContainerId: "4d1b2c3e4f5a", Name: "db", Addresses: []netip.Prefix{netip.MustParsePrefix("10.32.0.2/12"), netip.MustParsePrefix("10.44.0.3/24")}},
+		{ContainerId: "weave:expose", Addresses: []netip.Prefix{netip.MustParsePrefix("10.44.0.1/24")}},
+	}, list)
+
+	list, err = w.SubnetAddresses(context.Background(), netip.MustParsePrefix("10.44.0.0/24"))
+	require.NoError(t, err)
+	require.Equal(t, []ContainerAddresses{
+		{ContainerId: "4d1b2c3e4f5a", Name: "db", Addresses: []netip.Prefix{netip.MustParsePrefix("10.44.0.3/24")}},
+		{ContainerId: "weave:expose", Addresses: []netip.Prefix{netip.MustParsePrefix("10.44.0.1/24")}},
+	}, list)
+
+	prefixes, err := w.ContainerAddresses(context.Background(), "77aa00bb11cc")
+	require.NoError(t, err)
+	require.Empty(t, prefixes)
+}
@@ -1,42 +1,44 @@
 package go_weave_api
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
-	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strings"
 )
 
-func (w *Weave) Attach(containerId string, withoutDNS, rewriteHost, noMulticastRoute bool, hosts []string, addr ...string) error {
-	cidrArgs := collectValidCIDR(addr)
-
+// Attach connects the container to the weave network with the addresses of
+// opts and registers its name in weaveDNS.
+func (w *Weave) Attach(containerId string, opts AttachOptions) (*AddressResult, error) {
 	containerId, err := getContainerIdByName(w.dockerCli, containerId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, allCIDRs, err := w.ipamCIDRs("allocate", containerId, cidrArgs)
+	allocated, all, err := w.ipamCIDRs("allocate", containerId, opts.Addresses)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	allCIDRs := prefixStrings(all)
 
-	if rewriteHost {
+	if opts.RewriteHosts {
 		args := []string{"rewrite-etc-hosts", containerId, fmt.Sprintf("weaveworks/weaveexec:%s", w.version)}
 		args = append(args, allCIDRs...)
-		args = append(args, hosts...)
+		args = append(args, opts.Hosts...)
 		if _, err = w.runWeaveExec(args...); err != nil {
-			return err
+			return nil, err
 		}
 	}
 	var attachArgs []string
-	if noMulticastRoute {
+	if opts.NoMulticastRoute {
 		attachArgs = append(attachArgs, "--no-multicast-route")
 	}
-	awsvpc, err := detectAWSVPC(fmt.Sprintf("%s:%d", w.address, w.httpPort))
+	awsvpc, err := w.isAWSVPC(context.Background())
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if awsvpc {
 		attachArgs = append(attachArgs, "--keep-tx-on")
@@ -45,162 +47,140 @@ func (w *Weave) Attach(containerId string, withoutDNS, rewriteHost, noMulticastR
 	attachArgs = append(attachArgs, containerId, "weave")
 	attachArgs = append(attachArgs, allCIDRs...)
 	if _, err = w.runWeaveExec(attachArgs...); err != nil {
-		return err
+		return nil, err
 	}
 
-	if !withoutDNS {
-		containerFqdnBytes, err := w.runWeaveExec("container-fqdn", containerId)
+	if !opts.WithoutDNS {
+		containerFqdn, err := w.containerFqdn(containerId)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		containerFqdn := string(containerFqdnBytes[8:])
-
 		containerName := strings.Split(containerFqdn, ".")[0]
 		if containerName != containerFqdn || fmt.Sprintf("%s.", containerName) != containerFqdn {
-			for _, cidr := range allCIDRs {
-				addr, _, found := strings.Cut(cidr, "/")
-				if !found {
-					// the cidr is invalid, ignore it
-					continue
-				}
+			for _, prefix := range all {
 				values := url.Values{}
 				values.Add("fqdn", containerFqdn)
 				values.Add("check-alive", "true")
 				if _, err := callWeave(http.MethodPut, fmt.Sprintf("http://%s:%d/name/%s/%s",
-					w.address, w.httpPort, containerId, addr), strings.NewReader(values.Encode())); err != nil {
-					return err
+					w.address, w.httpPort, containerId, prefix.Addr()), strings.NewReader(values.Encode())); err != nil {
+					return nil, err
 				}
 			}
 		}
 	}
 
-	return nil
+	return &AddressResult{ContainerId: containerId, Addresses: all, Allocated: allocated}, nil
 }
 
-func (w *Weave) Detach(containerId string, addr ...string) error {
-	cidrArgs := collectValidCIDR(addr)
-
+// Detach disconnects the container from the addresses, all its addresses
+// when none are given, and releases the addresses allocated by ipam.
+func (w *Weave) Detach(containerId string, addrs ...AddressSpec) (*AddressResult, error) {
 	containerId, err := getContainerIdByName(w.dockerCli, containerId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	ipamCIDRs, all, err := w.ipamCIDRs("lookup", containerId, cidrArgs)
+	allocated, all, err := w.ipamCIDRs("lookup", containerId, addrs)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	execArgs := []string{"detach-container"}
-	execArgs = append(execArgs, all...)
+	execArgs := []string{"detach-container", containerId}
+	execArgs = append(execArgs, prefixStrings(all)...)
 	_, err = w.runWeaveExec(execArgs...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	containerFqdnBytes, err := w.runWeaveExec("container-fqdn", containerId)
+	containerFqdn, err := w.containerFqdn(containerId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	containerFqdn := string(containerFqdnBytes[8:])
-
 	containerName := strings.Split(containerFqdn, ".")[0]
 	if containerName != containerFqdn || fmt.Sprintf("%s.", containerName) != containerFqdn {
-		for _, cidr := range all {
-			addr, _, found := strings.Cut(cidr, "/")
-			if !found {
-				// the cidr is invalid, ignore it
-				continue
-			}
+		for _, prefix := range all {
 			if _, err := callWeave(http.MethodDelete, fmt.Sprintf("http://%s:%d/name/%s/%s?fqdn=%s",
-				w.address, w.httpPort, containerId, addr, containerFqdn), nil); err != nil {
-				return err
+				w.address, w.httpPort, containerId, prefix.Addr(), containerFqdn), nil); err != nil {
+				return nil, err
 			}
 		}
 	}
 
-	for _, cidr := range ipamCIDRs {
-		addr, _, found := strings.Cut(cidr, "/")
-		if !found {
-			// the cidr is invalid, ignore it
-			continue
-		}
+	for _, prefix := range allocated {
 		if _, err = callWeave(http.MethodDelete, fmt.Sprintf("http://%s:%d/ip/%s/%s",
-			w.address, w.httpPort, containerId, addr), nil); err != nil {
-			return err
+			w.address, w.httpPort, containerId, prefix.Addr()), nil); err != nil {
+			return nil, err
 		}
 	}
-	return nil
+	return &AddressResult{ContainerId: containerId, Addresses: all, Allocated: allocated}, nil
 }
 
-func (w *Weave) Expose(fqdn string, withoutMasquerade bool, addr ...string) ([]string, error) {
-	cidrArgs := collectValidCIDR(addr)
-
-	_, allCIDRs, err := w.ipamCIDRs("allocate_no_check_alive", "weave:expose", cidrArgs)
+// Expose gives the host the addresses on the weave bridge, fqdn is registered
+// in weaveDNS for them when it is not empty.
+func (w *Weave) Expose(fqdn string, withoutMasquerade bool, addrs ...AddressSpec) (*AddressResult, error) {
+	allocated, all, err := w.ipamCIDRs("allocate_no_check_alive", "weave:expose", addrs)
 	if err != nil {
 		return nil, err
 	}
 	var skipNAT string
-	if !withoutMasquerade {
+	if withoutMasquerade {
 		skipNAT = "?skipNAT=true"
 	}
 
-	for _, cidr := range allCIDRs {
+	for _, prefix := range all {
 		_, err := callWeave(http.MethodPost, fmt.Sprintf("http://%s:%d/expose/%s%s",
-			w.address, w.httpPort, cidr, skipNAT), nil)
+			w.address, w.httpPort, prefix, skipNAT), nil)
 		if err != nil {
 			return nil, err
 		}
 
 		if fqdn != "" {
-			if err := w.dns.addWeaveDNS("weave:expose", cidr, fqdn, true); err != nil {
+			if err := w.dns.addWeaveDNS("weave:expose", prefix.Addr().String(), fqdn, true); err != nil {
 				return nil, err
 			}
 		}
 	}
 
-	return allCIDRs, nil
+	return &AddressResult{ContainerId: "weave:expose", Addresses: all, Allocated: allocated}, nil
 }
 
-func (w *Weave) Hide(addr ...string) ([]string, error) {
-	cidrArgs := collectValidCIDR(addr)
-	ipamCIDRs, allCIDRs, err := w.ipamCIDRs("lookup", "weave:expose", cidrArgs)
+// Hide removes the exposed addresses from the host, all of them when none are
+// given. The iptables rules of an address are kept while another exposed
+// address or the ip range uses the same subnet.
+func (w *Weave) Hide(addrs ...AddressSpec) (*AddressResult, error) {
+	allocated, all, err := w.ipamCIDRs("lookup", "weave:expose", addrs)
 	if err != nil {
 		return nil, err
 	}
 
-	iptablesCmd := `
-ip addr del dev weave %[1]s && \
-iptables -w -t nat -C WEAVE -d %[1]s ! -s %[1]s -j MASQUERADE && \
-iptables -w -t nat -D WEAVE -d %[1]s ! -s %[1]s -j MASQUERADE && \
-iptables -w -t nat -C WEAVE -s %[1]s ! -d %[1]s -j MASQUERADE && \
-iptables -w -t nat -D WEAVE -s %[1]s ! -d %[1]s -j MASQUERADE && \
-iptables -w -t filter -C WEAVE_EXPOSE -d %[1]s -j ACCEPT && \
-iptables -w -t filter -D WEAVE_EXPOSE -d %[1]s -j ACCEPT
-`
-
-	for _, cidr := range allCIDRs {
-		// forget errors
-		_, _ = w.runRemoteCmdWithContainer("sh", "-c", fmt.Sprintf(iptablesCmd, cidr))
+	bridge, _, err := w.exposeState()
+	if err != nil {
+		return nil, err
 	}
-
-	for _, cidr := range ipamCIDRs {
-		addr, _, found := strings.Cut(cidr, "/")
-		if !found {
-			// the cidr is invalid, ignore it
-			continue
+	for _, prefix := range all {
+		onBridge := containsPrefix(bridge, prefix)
+		bridge = removePrefix(bridge, prefix)
+		removeRules := onBridge && !sharedRules(prefix, bridge, w.ipRangeSubnet())
+		if err := w.hideAddress(context.Background(), prefix, removeRules, false); err != nil {
+			return nil, err
 		}
+	}
+
+	for _, prefix := range allocated {
 		_, err := callWeave(http.MethodDelete, fmt.Sprintf("http://%s:%d/ip/weave:expose/%s",
-			w.address, w.httpPort, addr), nil)
+			w.address, w.httpPort, prefix.Addr()), nil)
 		if err != nil {
 			return nil, err
 		}
 	}
-	return allCIDRs, nil
+	return &AddressResult{ContainerId: "weave:expose", Addresses: all, Allocated: allocated}, nil
 }
 
-func (w *Weave) ipamCIDRs(funcName string, containerId string, cidrArgs []string) ([]string, []string, error) {
+// ipamCIDRs resolves the specs to addresses, it returns the addresses of ipam
+// and all addresses including the static ips. An invalid spec is an error.
+func (w *Weave) ipamCIDRs(funcName string, containerId string, specs []AddressSpec) ([]netip.Prefix, []netip.Prefix, error) {
 	var method, checkAlive string
 	baseURL := fmt.Sprintf("%s:%d", w.address, w.httpPort)
 	switch funcName {
@@ -211,90 +191,122 @@ func (w *Weave) ipamCIDRs(funcName string, containerId string, cidrArgs []string
 	case "allocate":
 		method = http.MethodPost
 		checkAlive = "?check-alive=true"
-		detected, err := detectAWSVPC(baseURL)
+	}
+	if method == http.MethodPost {
+		awsvpc, err := w.isAWSVPC(context.Background())
 		if err != nil {
 			return nil, nil, err
 		}
-		if !detected && restArgLen(containerId, cidrArgs) > 2 {
-			return nil, nil, errors.New("Error: no IP addresses or subnets may be specified in AWSVPC mode")
+		if awsvpc {
+			if err := validateAWSVPCAddresses(specs); err != nil {
+				return nil, nil, err
+			}
 		}
 	}
-	if len(cidrArgs) == 0 {
-		cidrArgs = append(cidrArgs, "net:default")
+	if len(specs) == 0 {
+		specs = []AddressSpec{DefaultSubnet()}
 	}
-	var ipamCIDRs, allCIDRs []string
-	for _, arg := range cidrArgs {
-		var ipamUrl string
-		if strings.Contains(arg, "net:") {
-			if arg == "net:default" {
-				ipamUrl = fmt.Sprintf("/ip/%s", containerId)
-			} else {
-				_, address, _ := strings.Cut(arg, "net:")
-				ipamUrl = fmt.Sprintf("/ip/%s/%s", containerId, address)
-			}
-			result, err := callWeave(method, fmt.Sprintf("http://%s%s%s", baseURL, ipamUrl, checkAlive), nil)
+	var ipamCIDRs, allCIDRs []netip.Prefix
+	for _, spec := range specs {
+		if spec.IsStaticIP() {
+			prefix, err := spec.Prefix()
 			if err != nil {
 				return nil, nil, err
 			}
-			ipamCIDRs = append(ipamCIDRs, string(result))
-			allCIDRs = append(allCIDRs, string(result))
-		} else {
 			if method == http.MethodPost {
-				if err := w.checkOverlap(arg, "weave"); err != nil {
+				if err := w.checkOverlap(prefix.String(), "weave"); err != nil {
 					return nil, nil, err
 				}
-				_, err := callWeave(http.MethodPut, fmt.Sprintf("http://%s/ip/%s%s%s", baseURL, containerId, arg, checkAlive), nil)
+				_, err := callWeave(http.MethodPut, fmt.Sprintf("http://%s/ip/%s/%s%s", baseURL, containerId, prefix, checkAlive), nil)
 				if err != nil {
 					return nil, nil, err
 				}
 			}
-			allCIDRs = append(allCIDRs, arg)
+			allCIDRs = append(allCIDRs, prefix)
+			continue
+		}
+
+		ipamUrl := fmt.Sprintf("/ip/%s", containerId)
+		switch {
+		case spec.IsSubnet():
+			subnet, err := spec.Prefix()
+			if err != nil {
+				return nil, nil, err
+			}
+			ipamUrl = fmt.Sprintf("/ip/%s/%s", containerId, subnet)
+		case spec.IsApplication():
+			subnet, err := w.applicationSubnet(spec.Application(), method == http.MethodPost)
+			if err != nil {
+				return nil, nil, err
+			}
+			ipamUrl = fmt.Sprintf("/ip/%s/%s", containerId, subnet)
+		}
+		result, err := callWeave(method, fmt.Sprintf("http://%s%s%s", baseURL, ipamUrl, checkAlive), nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		prefixes, err := parsePrefixes(string(result))
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "ipam returned an invalid address for %s", spec)
 		}
+		ipamCIDRs = append(ipamCIDRs, prefixes...)
+		allCIDRs = append(allCIDRs, prefixes...)
 	}
 
 	return ipamCIDRs, allCIDRs, nil
 }
 
-func restArgLen(containerId string, args []string) int {
-	num := 0
-	if containerId != "" {
-		num++
+// applicationSubnet returns the subnet of the application, with assign a new
+// subnet is planned when the application has none yet.
+func (w *Weave) applicationSubnet(name string, assign bool) (netip.Prefix, error) {
+	if w.planner == nil {
+		return netip.Prefix{}, errors.Errorf("application %s needs a subnet planner, see WithSubnetPlanner", name)
+	}
+	if !assign {
+		subnet, ok := w.planner.Lookup(name)
+		if !ok {
+			return netip.Prefix{}, errors.Errorf("application %s has no subnet", name)
+		}
+		return subnet, nil
+	}
+	bits := w.planner.Bits
+	if bits == 0 {
+		bits = DefaultApplicationBits
 	}
-	num += len(args)
-	return num
+	return w.planner.Assign(name, bits)
 }
 
-func detectAWSVPC(baseURL string) (bool, error) {
-	result, err := callWeave(http.MethodGet, fmt.Sprintf("http://%s/ipinfo/tracker", baseURL), nil)
+// containerFqdn returns the hostname and domain name of the container.
+func (w *Weave) containerFqdn(containerId string) (string, error) {
+	result, err := w.runWeaveExec("container-fqdn", containerId)
 	if err != nil {
-		return false, err
+		return "", err
 	}
-	return string(result) != "awsvpc", nil
+	return strings.TrimSpace(string(result)), nil
 }
 
-func collectValidCIDR(cidrs []string) []string {
-	var cidrArgs []string
-	for _, s := range cidrs {
-		if s == "net:default" {
-			cidrArgs = append(cidrArgs, "net:default")
-			continue
-		}
-		if isCIDR(s) {
-			cidrArgs = append(cidrArgs, s)
+// containerAddrs returns the CIDRs ipam has allocated to the container
+func (w *Weave) containerAddrs(ctx context.Context, containerId string) ([]string, error) {
+	result, err := callWeaveContext(ctx, http.MethodGet, fmt.Sprintf("http://%s:%d/ip/%s",
+		w.address, w.httpPort, containerId), nil)
+	if err != nil {
+		if isHTTPNotFound(err) {
+			return nil, nil
 		}
+		return nil, err
 	}
-
-	return cidrArgs
+	return strings.Fields(string(result)), nil
 }
 
-func isCIDR(addr string) bool {
-	_, naddr, found := strings.Cut(addr, "net:")
-	if !found {
-		_, naddr, found = strings.Cut(addr, "ip:")
-		if !found {
-			naddr = addr
+// parsePrefixes parses the space separated CIDRs returned by ipam.
+func parsePrefixes(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Fields(s) {
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, err
 		}
+		prefixes = append(prefixes, prefix)
 	}
-	_, _, err := net.ParseCIDR(naddr)
-	return err == nil
+	return prefixes, nil
 }
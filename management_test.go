@@ -1,8 +1,10 @@
 package go_weave_api
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/require"
 	"net/http"
+	"sync"
 	"testing"
 )
 
@@ -13,8 +15,8 @@ func TestA(t *testing.T) {
 }
 
 func TestIsCIDRs(t *testing.T) {
-	cidr := isCIDR("net:10.123.11.0/24")
-	t.Log(cidr)
+	spec, err := ParseAddressSpec("net:10.123.11.0/24")
+	t.Log(spec, err)
 }
 
 func TestWeave_Attach(t *testing.T) {
@@ -22,25 +24,54 @@ func TestWeave_Attach(t *testing.T) {
 	require.NoError(t, err)
 	defer w.Close()
 
-	err = w.Attach("box", false, false, false, nil, "net:10.44.0.0/24")
+	_, err = w.Attach("box", AttachOptions{Addresses: []AddressSpec{Subnet("10.44.0.0/24")}})
 	require.NoError(t, err)
 
-	err = w.Detach("box", "net:default")
+	_, err = w.Detach("box", DefaultSubnet())
 	require.NoError(t, err)
 }
 
 func TestWeave_Expose(t *testing.T) {
 	w, _ := NewWeaveNode("127.0.0.1")
 	defer w.Close()
-	exposes, err := w.Expose("", false, "net:default", "net:10.44.0.0/24")
+	exposes, err := w.Expose("", false, DefaultSubnet(), Subnet("10.44.0.0/24"))
 	require.NoError(t, err)
-	require.Equal(t, 2, len(exposes))
+	require.Equal(t, 2, len(exposes.Addresses))
 	t.Log(exposes)
 }
 
 func TestWeave_Hide(t *testing.T) {
 	w, _ := NewWeaveNode("127.0.0.1")
 	defer w.Close()
-	_, err := w.Hide("net:10.44.0.0/24")
+	_, err := w.Hide(Subnet("10.44.0.0/24"))
 	require.NoError(t, err)
 }
+
+func TestWeave_DetachArgs(t *testing.T) {
+	var mu sync.Mutex
+	var detached [][]string
+	mux := http.NewServeMux()
+	fakeWeaveExec(mux, func(cmd []string) (string, string, int) {
+		switch cmd[1] {
+		case "detach-container":
+			mu.Lock()
+			detached = append(detached, cmd[1:])
+			mu.Unlock()
+		case "container-fqdn":
+			return "web.weave.local\n", "", 0
+		}
+		return "", "", 0
+	})
+	mux.HandleFunc("/ip/", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(rw, "10.32.0.7/12 10.44.0.1/24")
+		}
+	})
+	mux.HandleFunc("/name/", func(rw http.ResponseWriter, r *http.Request) {})
+	w := newFakeDockerRouter(t, mux)
+
+	result, err := w.Detach("90440c9f28af")
+	require.NoError(t, err)
+	require.Len(t, result.Addresses, 2)
+	require.Equal(t, [][]string{{"detach-container", "90440c9f28af", "10.32.0.7/12", "10.44.0.1/24"}}, detached)
+}
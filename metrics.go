@@ -0,0 +1,182 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MetricSample is one sample of the prometheus exposition format.
+type MetricSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Metrics is the parsed output of the router's /metrics endpoint. The known
+// weave metrics are lifted into typed fields, everything else stays in Samples.
+type Metrics struct {
+	Samples []MetricSample
+	// ConnectionsByState is weave_connections, keyed by the state label
+	ConnectionsByState        map[string]int
+	ConnectionTerminations    int
+	FastDPFlows               int
+	IPs                       int
+	MaxIPs                    int
+	IPAMUnreachableCount      int
+	IPAMUnreachablePercentage float64
+	IPAMPendingAllocates      int
+	IPAMPendingClaims         int
+	// DNSEntries is the sum of weave_dns_entries over all its labels
+	DNSEntries int
+}
+
+// Metrics scrapes the prometheus metrics served on the status address of the
+// router, see WithStatusPort.
+func (w *Weave) Metrics(ctx context.Context) (*Metrics, error) {
+	data, err := callWeaveContext(ctx, http.MethodGet,
+		fmt.Sprintf("http://%s:%d/metrics", w.address, w.statusPort), nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseMetrics(data)
+}
+
+// Value returns the value of the first sample with the given name whose
+// labels contain all the given labels.
+func (m *Metrics) Value(name string, labels map[string]string) (float64, bool) {
+	for _, sample := range m.Samples {
+		if sample.Name != name {
+			continue
+		}
+		matched := true
+		for k, v := range labels {
+			if sample.Labels[k] != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return sample.Value, true
+		}
+	}
+	return 0, false
+}
+
+func parseMetrics(data []byte) (*Metrics, error) {
+	metrics := &Metrics{ConnectionsByState: make(map[string]int)}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sample, err := parseMetricSample(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid metrics at line %d", i+1)
+		}
+		metrics.Samples = append(metrics.Samples, sample)
+
+		switch sample.Name {
+		case "weave_connections":
+			metrics.ConnectionsByState[sample.Labels["state"]] += int(sample.Value)
+		case "weave_connection_terminations_total":
+			metrics.ConnectionTerminations = int(sample.Value)
+		case "weave_flows":
+			metrics.FastDPFlows = int(sample.Value)
+		case "weave_ips":
+			metrics.IPs += int(sample.Value)
+		case "weave_max_ips":
+			metrics.MaxIPs = int(sample.Value)
+		case "weave_ipam_unreachable_count":
+			metrics.IPAMUnreachableCount = int(sample.Value)
+		case "weave_ipam_unreachable_percentage":
+			metrics.IPAMUnreachablePercentage = sample.Value
+		case "weave_ipam_pending_allocates":
+			metrics.IPAMPendingAllocates = int(sample.Value)
+		case "weave_ipam_pending_claims":
+			metrics.IPAMPendingClaims = int(sample.Value)
+		case "weave_dns_entries":
+			metrics.DNSEntries += int(sample.Value)
+		}
+	}
+	return metrics, nil
+}
+
+// parseMetricSample parses `name{label="value",...} value [timestamp]`
+func parseMetricSample(line string) (MetricSample, error) {
+	sample := MetricSample{}
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd <= 0 {
+		return sample, errors.Errorf("missing value in %q", line)
+	}
+	sample.Name = line[:nameEnd]
+	rest := line[nameEnd:]
+
+	if rest[0] == '{' {
+		labels, n, err := parseMetricLabels(rest)
+		if err != nil {
+			return sample, err
+		}
+		sample.Labels = labels
+		rest = rest[n:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return sample, errors.Errorf("invalid sample %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, errors.Errorf("invalid value of sample %q", line)
+	}
+	sample.Value = value
+	return sample, nil
+}
+
+// parseMetricLabels parses the label set at the beginning of s and returns
+// the number of bytes consumed.
+func parseMetricLabels(s string) (map[string]string, int, error) {
+	labels := make(map[string]string)
+	i := 1
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return nil, 0, errors.Errorf("unterminated labels in %q", s)
+		}
+		if s[i] == '}' {
+			return labels, i + 1, nil
+		}
+
+		eq := strings.IndexByte(s[i:], '=')
+		if eq <= 0 || i+eq+1 >= len(s) || s[i+eq+1] != '"' {
+			return nil, 0, errors.Errorf("invalid label in %q", s)
+		}
+		name := strings.TrimSpace(s[i : i+eq])
+		i += eq + 2
+
+		var value strings.Builder
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return nil, 0, errors.Errorf("unterminated label value in %q", s)
+		}
+		labels[name] = value.String()
+		i++
+	}
+}
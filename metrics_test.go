@@ -0,0 +1,66 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+const testMetrics = `# HELP weave_connections Number of peer-to-peer connections.
+# TYPE weave_connections gauge
+weave_connections{state="established",type="fastdp"} 2
+weave_connections{state="established",type="sleeve"} 1
+weave_connections{state="failed"} 1
+weave_connection_terminations_total 4
+weave_flows 12
+weave_ips{state="local-used"} 3
+weave_max_ips 1048576
+weave_ipam_unreachable_count 1
+weave_ipam_unreachable_percentage 33.3
+weave_ipam_pending_allocates 0
+weave_ipam_pending_claims 0
+weave_dns_entries{state="local"} 5
+weave_dns_entries{state="remote"} 2
+go_info{version="go1.15.2 \"x\""} 1 1660000000000
+`
+
+func TestParseMetrics(t *testing.T) {
+	metrics, err := parseMetrics([]byte(testMetrics))
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"established": 3, "failed": 1}, metrics.ConnectionsByState)
+	require.Equal(t, 4, metrics.ConnectionTerminations)
+	require.Equal(t, 12, metrics.FastDPFlows)
+	require.Equal(t, 3, metrics.IPs)
+	require.Equal(t, 1048576, metrics.MaxIPs)
+	require.Equal(t, 1, metrics.IPAMUnreachableCount)
+	require.Equal(t, 33.3, metrics.IPAMUnreachablePercentage)
+	require.Equal(t, 7, metrics.DNSEntries)
+
+	value, ok := metrics.Value("weave_connections", map[string]string{"type": "sleeve"})
+	require.True(t, ok)
+	require.Equal(t, float64(1), value)
+	value, ok = metrics.Value("go_info", nil)
+	require.True(t, ok)
+	require.Equal(t, float64(1), value)
+	require.Equal(t, `go1.15.2 "x"`, metrics.Samples[len(metrics.Samples)-1].Labels["version"])
+
+	_, err = parseMetrics([]byte("weave_flows{state=\"x} 1"))
+	require.Error(t, err)
+	_, err = parseMetrics([]byte("weave_flows"))
+	require.Error(t, err)
+}
+
+func TestWeave_Metrics(t *testing.T) {
+	w := newFakeRouter(t, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/metrics", r.URL.Path)
+		fmt.Fprint(rw, testMetrics)
+	}))
+	// the fake router serves the status address on the same port
+	w.statusPort = w.httpPort
+
+	metrics, err := w.Metrics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 12, metrics.FastDPFlows)
+}
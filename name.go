@@ -0,0 +1,108 @@
+package go_weave_api
+
+import (
+	"github.com/pkg/errors"
+	"strings"
+)
+
+const (
+	maxDNSNameLen  = 253
+	maxDNSLabelLen = 63
+)
+
+// DNSName is a validated dns name. An absolute name ends with a dot in its
+// text form and is never qualified with a domain.
+type DNSName struct {
+	labels   []string
+	absolute bool
+}
+
+// ParseDNSName validates name, every label must be a RFC 1123 host name label.
+// The name is lower cased.
+func ParseDNSName(name string) (DNSName, error) {
+	n := DNSName{}
+	name = strings.TrimSpace(name)
+	if strings.HasSuffix(name, ".") {
+		n.absolute = true
+		name = strings.TrimSuffix(name, ".")
+	}
+	if name == "" {
+		return n, errors.New("empty dns name")
+	}
+	if len(name) > maxDNSNameLen {
+		return n, errors.Errorf("dns name %s is longer than %d characters", name, maxDNSNameLen)
+	}
+	for _, label := range strings.Split(strings.ToLower(name), ".") {
+		if err := validateDNSLabel(label); err != nil {
+			return n, errors.Wrapf(err, "invalid dns name %s", name)
+		}
+		n.labels = append(n.labels, label)
+	}
+	return n, nil
+}
+
+func validateDNSLabel(label string) error {
+	if label == "" {
+		return errors.New("empty label")
+	}
+	if len(label) > maxDNSLabelLen {
+		return errors.Errorf("label %s is longer than %d characters", label, maxDNSLabelLen)
+	}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-':
+			if i == 0 || i == len(label)-1 {
+				return errors.Errorf("label %s starts or ends with a hyphen", label)
+			}
+		default:
+			return errors.Errorf("label %s contains the invalid character %q", label, c)
+		}
+	}
+	return nil
+}
+
+func (n DNSName) String() string {
+	s := strings.Join(n.labels, ".")
+	if n.absolute {
+		s += "."
+	}
+	return s
+}
+
+func (n DNSName) IsAbsolute() bool {
+	return n.absolute
+}
+
+// InDomain reports whether the last labels of n are the labels of domain.
+func (n DNSName) InDomain(domain DNSName) bool {
+	if len(n.labels) < len(domain.labels) {
+		return false
+	}
+	offset := len(n.labels) - len(domain.labels)
+	for i, label := range domain.labels {
+		if n.labels[offset+i] != label {
+			return false
+		}
+	}
+	return true
+}
+
+// Qualify returns the absolute name of n. A relative name which is not in
+// domain yet gets domain appended.
+func (n DNSName) Qualify(domain DNSName) DNSName {
+	qualified := DNSName{labels: n.labels, absolute: true}
+	if !n.absolute && !n.InDomain(domain) {
+		qualified.labels = append(append([]string{}, n.labels...), domain.labels...)
+	}
+	return qualified
+}
+
+// Relative returns n without domain, n is returned as is when it is not in domain.
+func (n DNSName) Relative(domain DNSName) DNSName {
+	if !n.InDomain(domain) || len(n.labels) == len(domain.labels) {
+		return n
+	}
+	return DNSName{labels: n.labels[:len(n.labels)-len(domain.labels)]}
+}
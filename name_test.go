@@ -0,0 +1,61 @@
+package go_weave_api
+
+import (
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestParseDNSName(t *testing.T) {
+	domain, err := ParseDNSName("weave.local.")
+	require.NoError(t, err)
+	require.True(t, domain.IsAbsolute())
+
+	for name, qualified := range map[string]string{
+		"box":                     "box.weave.local.",
+		"Box.Weave.Local":         "box.weave.local.",
+		"box.weave.local.":        "box.weave.local.",
+		"db.prod":                 "db.prod.weave.local.",
+		"weave.localhost.example": "weave.localhost.example.weave.local.",
+		"api.example.com.":        "api.example.com.",
+		"a-1.weave.local":         "a-1.weave.local.",
+	} {
+		n, err := ParseDNSName(name)
+		require.NoError(t, err, name)
+		require.Equal(t, qualified, n.Qualify(domain).String(), name)
+	}
+
+	n, err := ParseDNSName("box.weave.local")
+	require.NoError(t, err)
+	require.Equal(t, "box", n.Relative(domain).String())
+	n, err = ParseDNSName("api.example.com")
+	require.NoError(t, err)
+	require.Equal(t, "api.example.com", n.Relative(domain).String())
+
+	for _, name := range []string{"", ".", "box..weave", "-box", "box-", "box_1", "bo x",
+		strings.Repeat("a", 64), strings.Repeat("a.", 127) + "a"} {
+		_, err := ParseDNSName(name)
+		require.Error(t, err, name)
+	}
+}
+
+func TestDNSServer_Qualify(t *testing.T) {
+	dns := NewDNSServer("", "weave.local", false)
+	for name, qualified := range map[string]string{
+		"box":             "box.weave.local.",
+		"box.":            "box.",
+		"box.weave.local": "box.weave.local.",
+		"example.com":     "example.com.",
+	} {
+		fqdn, err := dns.qualify(name)
+		require.NoError(t, err)
+		require.Equal(t, qualified, fqdn)
+	}
+	require.Equal(t, "box", dns.relative("box.weave.local."))
+
+	fqdn, err := dns.fqdn("db.prod")
+	require.NoError(t, err)
+	require.Equal(t, "db.prod.weave.local.", fqdn)
+	_, err = dns.fqdn("db_prod")
+	require.Error(t, err)
+}
@@ -104,6 +104,45 @@ func WithIpAllocDefaultSubnet(ipRange string) Option {
 	}
 }
 
+// WithSubnetPlanner resolves the Application address specs with planner.
+func WithSubnetPlanner(planner *SubnetPlanner) Option {
+	return func(weave *Weave) {
+		weave.planner = planner
+	}
+}
+
+// WithIPAllocConsensus splits the ip range by a consensus of n peers, the
+// node and its peers must be started with the same n.
+func WithIPAllocConsensus(n int) Option {
+	return func(weave *Weave) {
+		weave.ipAllocInits = append(weave.ipAllocInits, ipAllocInit{mode: ipAllocConsensus, consensus: n})
+	}
+}
+
+// WithIPAllocSeed splits the ip range between the peers with these names
+// without a consensus, the names are set with WithName.
+func WithIPAllocSeed(peerNames ...string) Option {
+	return func(weave *Weave) {
+		weave.ipAllocInits = append(weave.ipAllocInits, ipAllocInit{mode: ipAllocSeed, seed: peerNames})
+	}
+}
+
+// WithIPAllocObserver never takes part in splitting the ip range, the node
+// asks its peers for address space.
+func WithIPAllocObserver() Option {
+	return func(weave *Weave) {
+		weave.ipAllocInits = append(weave.ipAllocInits, ipAllocInit{mode: ipAllocObserver})
+	}
+}
+
+// WithAWSVPC launches the router with the awsvpc ipam tracker, the
+// addresses are routed by the AWS VPC route table.
+func WithAWSVPC() Option {
+	return func(weave *Weave) {
+		weave.awsvpc = true
+	}
+}
+
 func WithPort(port int) Option {
 	return func(weave *Weave) {
 		weave.port = port
@@ -113,6 +152,7 @@ func WithPort(port int) Option {
 func WithVersion(version string) Option {
 	return func(weave *Weave) {
 		weave.version = version
+		weave.versionSet = true
 	}
 }
 
@@ -122,6 +162,30 @@ func WithDNSAddress(address string) Option {
 	}
 }
 
+func WithDNSDomain(domain string) Option {
+	return func(weave *Weave) {
+		weave.dns.Search = domain
+	}
+}
+
+func WithDNSTTL(ttl int) Option {
+	return func(weave *Weave) {
+		weave.dns.TTL = ttl
+	}
+}
+
+func WithDNSFallback(servers ...string) Option {
+	return func(weave *Weave) {
+		weave.dns.Fallback = servers
+	}
+}
+
+func WithDNSEffectiveListenAddress(address string) Option {
+	return func(weave *Weave) {
+		weave.dns.EffectiveAddress = address
+	}
+}
+
 func WithHostnameFromLabel(labelKey string) Option {
 	return func(weave *Weave) {
 		weave.hostnameFromLabel = labelKey
@@ -191,3 +255,9 @@ func NoFastdp() Option {
 		weave.disableFastDP = true
 	}
 }
+
+func NoDefaultIPAlloc() Option {
+	return func(weave *Weave) {
+		weave.noDefaultIpAlloc = true
+	}
+}
@@ -0,0 +1,263 @@
+package go_weave_api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"net/netip"
+	"os"
+	"sort"
+	"sync"
+)
+
+// DefaultApplicationBits is the prefix length of the application subnets
+// when SubnetPlanner.Bits is not set.
+const DefaultApplicationBits = 24
+
+// SubnetPlanner hands out non-overlapping subnets of the ip allocation range
+// to named applications. A subnet never overlaps the default subnet, the
+// subnets used by attached containers or the subnets of other applications.
+// The assignments are persisted to a json file when the planner has a path.
+type SubnetPlanner struct {
+	// Bits is the prefix length of Application address specs
+	Bits int
+	// Check reports whether a candidate subnet overlaps with a route of the
+	// host, overlapping candidates are skipped. It is not called when nil.
+	Check func(subnet netip.Prefix) (bool, error)
+
+	mu            sync.Mutex
+	path          string
+	ipRange       netip.Prefix
+	defaultSubnet netip.Prefix
+	used          []netip.Prefix
+	assignments   map[string]netip.Prefix
+}
+
+type subnetPlan struct {
+	Range         netip.Prefix            `json:"range"`
+	DefaultSubnet netip.Prefix            `json:"defaultSubnet"`
+	Assignments   map[string]netip.Prefix `json:"assignments"`
+}
+
+// NewSubnetPlanner creates a planner for ipRange. defaultSubnet defaults to
+// ipRange like in weave, which leaves no room for application subnets, so it
+// must be set to a part of the range. The assignments of path are loaded when
+// the file exists, path may be empty to keep them in memory only.
+func NewSubnetPlanner(ipRange, defaultSubnet, path string) (*SubnetPlanner, error) {
+	rng, err := netip.ParsePrefix(ipRange)
+	if err != nil || !rng.Addr().Is4() {
+		return nil, errors.Errorf("invalid ip range %q", ipRange)
+	}
+	rng = rng.Masked()
+	def := rng
+	if defaultSubnet != "" {
+		if def, err = netip.ParsePrefix(defaultSubnet); err != nil {
+			return nil, errors.Errorf("invalid default subnet %q", defaultSubnet)
+		}
+		def = def.Masked()
+	}
+	if def.Bits() <= rng.Bits() && def.Contains(rng.Addr()) {
+		return nil, errors.Errorf("default subnet %s covers the whole ip range %s, "+
+			"set a smaller default subnet to leave room for application subnets", def, rng)
+	}
+	p := &SubnetPlanner{
+		Bits:          DefaultApplicationBits,
+		path:          path,
+		ipRange:       rng,
+		defaultSubnet: def,
+		assignments:   make(map[string]netip.Prefix),
+	}
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadSubnetPlanner creates a planner for the ip range and the default subnet
+// of the node. The subnets of the containers attached to the node are marked
+// as used, candidate subnets are checked with netcheck. Attach resolves the
+// Application address specs with the planner.
+func (w *Weave) LoadSubnetPlanner(ctx context.Context, path string) (*SubnetPlanner, error) {
+	p, err := NewSubnetPlanner(w.ipRange, w.ipAllocDefaultSubnet, path)
+	if err != nil {
+		return nil, err
+	}
+	containers, err := w.ListContainerAddresses(ctx, DefaultIPAMConcurrency)
+	if err != nil {
+		return nil, err
+	}
+	for _, ctr := range containers {
+		p.AddUsed(ctr.Addresses...)
+	}
+	p.Check = func(subnet netip.Prefix) (bool, error) {
+		// netcheck reports an overlap on stderr and exits with 1
+		result, err := w.runRemoteCmdWithStatus("/usr/bin/weaveutil", "netcheck", subnet.String(), "weave")
+		if err != nil {
+			return false, err
+		}
+		return result.exitCode != 0, nil
+	}
+	w.planner = p
+	return p, nil
+}
+
+// AddUsed marks the subnets of addresses as used. An address inside the
+// default subnet is allocated from it and marks nothing.
+func (p *SubnetPlanner) AddUsed(addrs ...netip.Prefix) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, addr := range addrs {
+		subnet := addr.Masked()
+		if p.defaultSubnet.Contains(subnet.Addr()) && p.defaultSubnet.Bits() <= subnet.Bits() {
+			continue
+		}
+		p.used = append(p.used, subnet)
+	}
+}
+
+// Assign returns the subnet of the application, a new subnet with a prefix
+// length of bits is assigned and persisted when it has none yet.
+func (p *SubnetPlanner) Assign(name string, bits int) (netip.Prefix, error) {
+	if name == "" {
+		return netip.Prefix{}, errors.New("empty application name")
+	}
+	if bits < p.ipRange.Bits() || bits > 30 {
+		return netip.Prefix{}, errors.Errorf("application subnet /%d does not fit into the ip range %s", bits, p.ipRange)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if subnet, ok := p.assignments[name]; ok {
+		if subnet.Bits() != bits {
+			return netip.Prefix{}, errors.Errorf("application %s has the subnet %s already", name, subnet)
+		}
+		return subnet, nil
+	}
+
+	size := uint32(1) << (32 - bits)
+	start := addrToUint32(p.ipRange.Addr())
+	end := start + uint32(1)<<(32-p.ipRange.Bits()) - 1
+	for base := start; base >= start && base <= end; base += size {
+		candidate := netip.PrefixFrom(uint32ToAddr(base), bits)
+		if p.overlaps(candidate) {
+			continue
+		}
+		if p.Check != nil {
+			overlap, err := p.Check(candidate)
+			if err != nil {
+				return netip.Prefix{}, errors.Wrapf(err, "netcheck %s", candidate)
+			}
+			if overlap {
+				continue
+			}
+		}
+		p.assignments[name] = candidate
+		if err := p.save(); err != nil {
+			delete(p.assignments, name)
+			return netip.Prefix{}, err
+		}
+		return candidate, nil
+	}
+	return netip.Prefix{}, errors.Errorf("no free /%d subnet left in the ip range %s", bits, p.ipRange)
+}
+
+// Lookup returns the subnet assigned to the application.
+func (p *SubnetPlanner) Lookup(name string) (netip.Prefix, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	subnet, ok := p.assignments[name]
+	return subnet, ok
+}
+
+// Release forgets the subnet of the application, the addresses of its
+// containers are not touched.
+func (p *SubnetPlanner) Release(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	subnet, ok := p.assignments[name]
+	if !ok {
+		return nil
+	}
+	delete(p.assignments, name)
+	if err := p.save(); err != nil {
+		p.assignments[name] = subnet
+		return err
+	}
+	return nil
+}
+
+// Applications returns the names of the applications with a subnet, sorted.
+func (p *SubnetPlanner) Applications() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, 0, len(p.assignments))
+	for name := range p.assignments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *SubnetPlanner) overlaps(candidate netip.Prefix) bool {
+	if candidate.Overlaps(p.defaultSubnet) {
+		return true
+	}
+	for _, used := range p.used {
+		if candidate.Overlaps(used) {
+			return true
+		}
+	}
+	for _, assigned := range p.assignments {
+		if candidate.Overlaps(assigned) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *SubnetPlanner) load() error {
+	if p.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var plan subnetPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return errors.Wrapf(err, "invalid subnet plan %s", p.path)
+	}
+	for name, subnet := range plan.Assignments {
+		if !p.ipRange.Contains(subnet.Addr()) || subnet.Bits() < p.ipRange.Bits() {
+			return errors.Errorf("subnet %s of application %s in %s is outside of the ip range %s", subnet, name, p.path, p.ipRange)
+		}
+		p.assignments[name] = subnet
+	}
+	return nil
+}
+
+func (p *SubnetPlanner) save() error {
+	if p.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(subnetPlan{
+		Range:         p.ipRange,
+		DefaultSubnet: p.defaultSubnet,
+		Assignments:   p.assignments,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(p.path, data)
+}
+
+func addrToUint32(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+func uint32ToAddr(v uint32) netip.Addr {
+	return netip.AddrFrom4([4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
@@ -0,0 +1,117 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/netip"
+	"path/filepath"
+	"testing"
+)
+
+func TestSubnetPlanner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subnets.json")
+	p, err := NewSubnetPlanner("10.32.0.0/12", "10.32.0.0/16", path)
+	require.NoError(t, err)
+	p.AddUsed(netip.MustParsePrefix("10.32.4.7/16"), netip.MustParsePrefix("10.33.0.5/24"))
+	p.Check = func(subnet netip.Prefix) (bool, error) {
+		return subnet == netip.MustParsePrefix("10.33.1.0/24"), nil
+	}
+
+	web, err := p.Assign("web", 24)
+	require.NoError(t, err)
+	require.Equal(t, netip.MustParsePrefix("10.33.2.0/24"), web)
+	again, err := p.Assign("web", 24)
+	require.NoError(t, err)
+	require.Equal(t, web, again)
+	_, err = p.Assign("web", 26)
+	require.Error(t, err)
+
+	db, err := p.Assign("db", 23)
+	require.NoError(t, err)
+	require.Equal(t, netip.MustParsePrefix("10.33.4.0/23"), db)
+
+	// the assignments survive a restart
+	reloaded, err := NewSubnetPlanner("10.32.0.0/12", "10.32.0.0/16", path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"db", "web"}, reloaded.Applications())
+	subnet, ok := reloaded.Lookup("db")
+	require.True(t, ok)
+	require.Equal(t, db, subnet)
+
+	require.NoError(t, reloaded.Release("db"))
+	reloaded, err = NewSubnetPlanner("10.32.0.0/12", "10.32.0.0/16", path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"web"}, reloaded.Applications())
+
+	_, err = NewSubnetPlanner("10.40.0.0/16", "10.40.0.0/24", path)
+	require.Error(t, err)
+}
+
+func TestSubnetPlanner_Full(t *testing.T) {
+	// the default subnet is the whole range unless it is set
+	_, err := NewSubnetPlanner("10.32.0.0/12", "", "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "covers the whole ip range")
+	_, err = NewSubnetPlanner("10.32.0.0/12", "10.0.0.0/8", "")
+	require.Error(t, err)
+
+	p, err := NewSubnetPlanner("10.32.0.0/23", "10.32.0.0/24", "")
+	require.NoError(t, err)
+	_, err = p.Assign("web", 24)
+	require.NoError(t, err)
+	_, err = p.Assign("db", 24)
+	require.Error(t, err)
+}
+
+func TestWeave_AttachApplication(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ipinfo/tracker", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "ring")
+	})
+	mux.HandleFunc("/ip/90440c9f28af/10.33.0.0/24", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "10.33.0.1/24")
+	})
+	w := newFakeRouter(t, mux)
+
+	_, _, err := w.ipamCIDRs("allocate_no_check_alive", "90440c9f28af", []AddressSpec{Application("web")})
+	require.Error(t, err)
+
+	w.planner, err = NewSubnetPlanner("10.32.0.0/12", "10.32.0.0/16", "")
+	require.NoError(t, err)
+	_, _, err = w.ipamCIDRs("lookup", "90440c9f28af", []AddressSpec{Application("web")})
+	require.Error(t, err)
+
+	allocated, _, err := w.ipamCIDRs("allocate_no_check_alive", "90440c9f28af", []AddressSpec{Application("web")})
+	require.NoError(t, err)
+	require.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.33.0.1/24")}, allocated)
+}
+
+func TestWeave_LoadSubnetPlanner(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.41/containers/json", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `[{"Id":"90440c9f28af"}]`)
+	})
+	mux.HandleFunc("/ip/90440c9f28af", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "10.33.0.5/24")
+	})
+	mux.HandleFunc("/ip/", func(rw http.ResponseWriter, r *http.Request) {
+		http.NotFound(rw, r)
+	})
+	fakeWeaveExec(mux, func(cmd []string) (string, string, int) {
+		require.Equal(t, []string{"/usr/bin/weaveutil", "netcheck"}, cmd[:2])
+		if cmd[2] == "10.33.1.0/24" {
+			return "", "Network 10.33.1.0/24 overlaps with existing route 10.33.1.0/24 on host\n", 1
+		}
+		return "", "", 0
+	})
+	w := newFakeDockerRouter(t, mux)
+	w.ipRange, w.ipAllocDefaultSubnet = "10.32.0.0/12", "10.32.0.0/16"
+
+	p, err := w.LoadSubnetPlanner(context.Background(), "")
+	require.NoError(t, err)
+	subnet, err := p.Assign("web", 24)
+	require.NoError(t, err)
+	require.Equal(t, netip.MustParsePrefix("10.33.2.0/24"), subnet)
+}
@@ -0,0 +1,217 @@
+package go_weave_api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type ReclaimOptions struct {
+	// DryRun only reports the addresses which would be claimed
+	DryRun bool
+	// WithoutDNS skips the registration of the container names
+	WithoutDNS bool
+}
+
+// ReclaimConflict is an address which could not be claimed for a container.
+type ReclaimConflict struct {
+	ContainerId string
+	Address     netip.Prefix
+	// Owner is a local container holding the address as well, it is empty
+	// when the router refused the claim
+	Owner  string
+	Reason string
+}
+
+// ReclaimReport lists the addresses and names claimed again by Reclaim.
+type ReclaimReport struct {
+	DryRun bool
+	// Claimed are the addresses claimed per container, including weave:expose
+	Claimed map[string][]netip.Prefix
+	// Known are the addresses the router knew already
+	Known     map[string][]netip.Prefix
+	Names     map[string]string
+	Conflicts []ReclaimConflict
+}
+
+// containerInterface is a line of weaveutil container-addrs.
+type containerInterface struct {
+	containerId string
+	ifname      string
+	mac         string
+	addresses   []netip.Prefix
+}
+
+// Reclaim claims the addresses of the running containers with a weave
+// interface and of the weave bridge again, and registers the container names
+// in weaveDNS. A router which was restarted without its weavedb, or with
+// NoRestart, does not know these addresses and would hand them out twice.
+// An address held by two containers, or refused by the router, is reported
+// as a conflict and not claimed.
+func (w *Weave) Reclaim(ctx context.Context, opts ReclaimOptions) (*ReclaimReport, error) {
+	containers, err := w.dockerCli.ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"container-addrs", "weave"}
+	for _, ctr := range containers {
+		args = append(args, ctr.ID)
+	}
+	args = append(args, "weave:expose")
+	result, err := w.runWeaveExec(args...)
+	if err != nil {
+		return nil, err
+	}
+	ifaces, err := parseContainerAddrs(string(result))
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := w.reclaimAddresses(ctx, ifaces, opts.DryRun)
+	if err != nil {
+		return report, err
+	}
+	if opts.DryRun || opts.WithoutDNS || w.dns.Disabled {
+		return report, nil
+	}
+	for _, iface := range ifaces {
+		if iface.containerId == "weave:expose" {
+			continue
+		}
+		addrs := append(append([]netip.Prefix{}, report.Known[iface.containerId]...), report.Claimed[iface.containerId]...)
+		if len(addrs) == 0 {
+			continue
+		}
+		fqdn, err := w.containerFqdn(iface.containerId)
+		if err != nil {
+			return report, err
+		}
+		if !strings.Contains(strings.TrimSuffix(fqdn, "."), ".") {
+			// a name without domain is not in weaveDNS
+			continue
+		}
+		for _, addr := range addrs {
+			if err := w.dns.addWeaveDNS(iface.containerId, addr.Addr().String(), fqdn, false); err != nil {
+				return report, errors.Wrapf(err, "register %s of container %s", fqdn, iface.containerId)
+			}
+		}
+		report.Names[iface.containerId] = fqdn
+	}
+	return report, nil
+}
+
+func (w *Weave) reclaimAddresses(ctx context.Context, ifaces []containerInterface, dryRun bool) (*ReclaimReport, error) {
+	report := &ReclaimReport{
+		DryRun:  dryRun,
+		Claimed: make(map[string][]netip.Prefix),
+		Known:   make(map[string][]netip.Prefix),
+		Names:   make(map[string]string),
+	}
+	// an address held by several containers can not be given to any of them
+	holders := make(map[netip.Addr][]string)
+	for _, iface := range ifaces {
+		for _, addr := range iface.addresses {
+			if !containsString(holders[addr.Addr()], iface.containerId) {
+				holders[addr.Addr()] = append(holders[addr.Addr()], iface.containerId)
+			}
+		}
+	}
+	for _, iface := range ifaces {
+		known, err := w.ContainerAddresses(ctx, iface.containerId)
+		if err != nil {
+			return report, err
+		}
+		for _, addr := range iface.addresses {
+			if others := removeString(holders[addr.Addr()], iface.containerId); len(others) > 0 {
+				report.Conflicts = append(report.Conflicts, ReclaimConflict{
+					ContainerId: iface.containerId,
+					Address:     addr,
+					Owner:       others[0],
+					Reason:      fmt.Sprintf("address is held by container %s as well", strings.Join(others, ", ")),
+				})
+				continue
+			}
+			if containsPrefix(known, addr) {
+				report.Known[iface.containerId] = append(report.Known[iface.containerId], addr)
+				continue
+			}
+			if !dryRun {
+				if err := w.claimAddress(ctx, iface.containerId, addr); err != nil {
+					var statusErr *httpStatusError
+					if !errors.As(err, &statusErr) {
+						return report, err
+					}
+					report.Conflicts = append(report.Conflicts, ReclaimConflict{
+						ContainerId: iface.containerId,
+						Address:     addr,
+						Reason:      err.Error(),
+					})
+					continue
+				}
+			}
+			report.Claimed[iface.containerId] = append(report.Claimed[iface.containerId], addr)
+		}
+	}
+	return report, nil
+}
+
+func (w *Weave) claimAddress(ctx context.Context, containerId string, addr netip.Prefix) error {
+	var checkAlive string
+	if containerId != "weave:expose" {
+		checkAlive = "?check-alive=true"
+	}
+	_, err := callWeaveContext(ctx, http.MethodPut, fmt.Sprintf("http://%s:%d/ip/%s/%s%s",
+		w.address, w.httpPort, containerId, addr, checkAlive), nil)
+	return err
+}
+
+// parseContainerAddrs parses the output of weaveutil container-addrs, one
+// line per interface: <container id> <interface> <mac> <cidr>...
+func parseContainerAddrs(output string) ([]containerInterface, error) {
+	var ifaces []containerInterface
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, errors.Errorf("invalid container-addrs line %q", scanner.Text())
+		}
+		addrs, err := parsePrefixes(strings.Join(fields[3:], " "))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid container-addrs line %q", scanner.Text())
+		}
+		ifaces = append(ifaces, containerInterface{
+			containerId: fields[0],
+			ifname:      fields[1],
+			mac:         fields[2],
+			addresses:   addrs,
+		})
+	}
+	return ifaces, scanner.Err()
+}
+
+func removeString(s []string, v string) []string {
+	var kept []string
+	for _, e := range s {
+		if e != v {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+func containsPrefix(prefixes []netip.Prefix, p netip.Prefix) bool {
+	for _, e := range prefixes {
+		if e == p {
+			return true
+		}
+	}
+	return false
+}
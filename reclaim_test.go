@@ -0,0 +1,104 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseContainerAddrs(t *testing.T) {
+	ifaces, err := parseContainerAddrs(`90440c9f28af ethwe 6a:1c:2b:3d:4e:5f 10.32.0.1/12 10.44.0.3/24
+weave:expose weave 7e:02:03:04:05:06 10.32.0.2/12
+`)
+	require.NoError(t, err)
+	require.Equal(t, []containerInterface{
+		{containerId: "90440c9f28af", ifname: "ethwe", mac: "6a:1c:2b:3d:4e:5f",
+			addresses: []netip.Prefix{netip.MustParsePrefix("10.32.0.1/12"), netip.MustParsePrefix("10.44.0.3/24")}},
+		{containerId: "weave:expose", ifname: "weave", mac: "7e:02:03:04:05:06",
+			addresses: []netip.Prefix{netip.MustParsePrefix("10.32.0.2/12")}},
+	}, ifaces)
+
+	_, err = parseContainerAddrs("90440c9f28af ethwe 6a:1c:2b:3d:4e:5f 10.32.0.1")
+	require.Error(t, err)
+}
+
+func TestWeave_Reclaim(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.41/containers/json", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `[{"Id":"90440c9f28af"},{"Id":"4d1b2c3e4f5a"},{"Id":"77aa00bb11cc"}]`)
+	})
+	fakeWeaveExec(mux, func(cmd []string) (string, string, int) {
+		switch cmd[1] {
+		case "container-addrs":
+			require.Equal(t, []string{"weave", "90440c9f28af", "4d1b2c3e4f5a", "77aa00bb11cc", "weave:expose"}, cmd[2:])
+			return `90440c9f28af ethwe 6a:1c:2b:3d:4e:5f 10.32.0.3/12 10.32.0.1/12
+4d1b2c3e4f5a ethwe 6a:1c:2b:3d:4e:60 10.32.0.5/12 10.32.0.1/12
+77aa00bb11cc ethwe 6a:1c:2b:3d:4e:61 10.32.0.9/12
+weave:expose weave 7e:02:03:04:05:06 10.32.0.2/12
+`, "", 0
+		case "container-fqdn":
+			if cmd[2] == "90440c9f28af" {
+				return "web.weave.local\n", "", 0
+			}
+			return "db\n", "", 0
+		}
+		return "", "", 0
+	})
+	mux.HandleFunc("/ip/", func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/ip/weave:expose":
+			fmt.Fprint(rw, "10.32.0.2/12")
+		case r.Method == http.MethodGet:
+			http.NotFound(rw, r)
+		case r.URL.Path == "/ip/77aa00bb11cc/10.32.0.9/12":
+			http.Error(rw, "address 10.32.0.9 is already owned by 5e:a4:e5:b8:d1:b7", http.StatusBadRequest)
+		}
+	})
+	mux.HandleFunc("/name/", func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+	})
+	w := newFakeDockerRouter(t, mux)
+
+	report, err := w.Reclaim(context.Background(), ReclaimOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]netip.Prefix{
+		"90440c9f28af": {netip.MustParsePrefix("10.32.0.3/12")},
+		"4d1b2c3e4f5a": {netip.MustParsePrefix("10.32.0.5/12")},
+	}, report.Claimed)
+	require.Equal(t, map[string][]netip.Prefix{"weave:expose": {netip.MustParsePrefix("10.32.0.2/12")}}, report.Known)
+	require.Equal(t, map[string]string{"90440c9f28af": "web.weave.local"}, report.Names)
+	// both holders of 10.32.0.1 are conflicts
+	require.Len(t, report.Conflicts, 3)
+	require.Equal(t, "90440c9f28af", report.Conflicts[0].ContainerId)
+	require.Equal(t, "4d1b2c3e4f5a", report.Conflicts[0].Owner)
+	require.Equal(t, "4d1b2c3e4f5a", report.Conflicts[1].ContainerId)
+	require.Equal(t, "90440c9f28af", report.Conflicts[1].Owner)
+	require.Equal(t, "77aa00bb11cc", report.Conflicts[2].ContainerId)
+	require.Empty(t, report.Conflicts[2].Owner)
+	require.Contains(t, calls, "PUT /ip/90440c9f28af/10.32.0.3/12?check-alive=true")
+	require.Contains(t, calls, "PUT /name/90440c9f28af/10.32.0.3")
+	for _, call := range calls {
+		require.NotContains(t, call, "10.32.0.1/12", call)
+	}
+	require.NotContains(t, calls, "PUT /name/90440c9f28af/10.32.0.1")
+
+	calls = nil
+	report, err = w.Reclaim(context.Background(), ReclaimOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Len(t, report.Claimed, 3)
+	for _, call := range calls {
+		require.True(t, strings.HasPrefix(call, "GET "), call)
+	}
+}
@@ -0,0 +1,143 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type RemovePeerOptions struct {
+	// Force removes the local peer and peers which are still reachable, the
+	// address space of a reachable peer is then owned twice
+	Force bool
+}
+
+// PeerRemoval is the result of removing one peer.
+type PeerRemoval struct {
+	Peer string
+	// Node is the address of the node which took over the address space
+	Node string
+	// Reclaimed is the number of addresses taken over from the peer
+	Reclaimed int
+}
+
+// RemovePeer takes over the address space of the peers, which are peer names
+// or nicknames, so the space of retired hosts is not leaked. The local peer
+// and reachable peers are refused unless opts.Force is set. It must run on a
+// single node only, see RemovePeerFromCluster.
+func (w *Weave) RemovePeer(ctx context.Context, opts RemovePeerOptions, peers ...string) ([]PeerRemoval, error) {
+	if len(peers) == 0 {
+		return nil, errors.New("should provide at least 1 peer")
+	}
+	if !opts.Force {
+		if err := w.checkRemovablePeers(ctx, peers); err != nil {
+			return nil, err
+		}
+	}
+
+	var removals []PeerRemoval
+	for _, peer := range peers {
+		resp, err := callWeaveContext(ctx, http.MethodDelete, fmt.Sprintf("http://%s:%d/peer/%s",
+			w.address, w.httpPort, peer), nil)
+		if err != nil {
+			return removals, errors.Wrapf(err, "remove peer %s", peer)
+		}
+		reclaimed, err := parseRemovedPeer(string(resp))
+		if err != nil {
+			return removals, err
+		}
+		removals = append(removals, PeerRemoval{Peer: peer, Node: w.address, Reclaimed: reclaimed})
+	}
+	return removals, nil
+}
+
+// RemovePeerFromCluster removes the peers on one of the nodes. Every node
+// which is not removed itself must see the peers as unreachable, the first of
+// them takes over the address space. Removing a peer on several nodes at once
+// would make each of them own the space.
+func RemovePeerFromCluster(ctx context.Context, nodes []*Weave, peers ...string) ([]PeerRemoval, error) {
+	if len(peers) == 0 {
+		return nil, errors.New("should provide at least 1 peer")
+	}
+	var survivor *Weave
+	for _, node := range nodes {
+		overview, err := node.status(ctx, "")
+		if err != nil {
+			return nil, errors.Wrapf(err, "query status of node %s", node.address)
+		}
+		name, nickname := parsePeerName(overview.Overview.Router.Name)
+		if matchPeer(peers, name, nickname) {
+			continue
+		}
+		if err := node.checkRemovablePeers(ctx, peers); err != nil {
+			return nil, errors.Wrapf(err, "node %s", node.address)
+		}
+		if survivor == nil {
+			survivor = node
+		}
+	}
+	if survivor == nil {
+		return nil, errors.New("no surviving node to remove the peers on")
+	}
+	return survivor.RemovePeer(ctx, RemovePeerOptions{Force: true}, peers...)
+}
+
+// checkRemovablePeers refuses the local peer and the peers reachable from it.
+func (w *Weave) checkRemovablePeers(ctx context.Context, peers []string) error {
+	overview, err := w.status(ctx, "")
+	if err != nil {
+		return err
+	}
+	local, localNickname := parsePeerName(overview.Overview.Router.Name)
+	topology, err := w.Topology(ctx)
+	if err != nil {
+		return err
+	}
+	nicknames := make(map[string]string, len(topology.Nodes))
+	for _, node := range topology.Nodes {
+		nicknames[node.Name] = node.Nickname
+	}
+
+	for _, peer := range peers {
+		if matchPeer([]string{peer}, local, localNickname) {
+			return errors.Errorf("peer %s is the local peer", peer)
+		}
+	}
+	for _, name := range topology.Reachable(local) {
+		if name != local && matchPeer(peers, name, nicknames[name]) {
+			return errors.Errorf("peer %s is still reachable", name)
+		}
+	}
+	return nil
+}
+
+// matchPeer reports whether one of peers is the peer name or its nickname.
+func matchPeer(peers []string, name, nickname string) bool {
+	normalized, _ := normalizePeerName(name)
+	for _, peer := range peers {
+		if n, ok := normalizePeerName(peer); ok && n == normalized {
+			return true
+		}
+		if nickname != "" && peer == nickname {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRemovedPeer parses the response of DELETE /peer, e.g.
+// "1024 IPs taken over from host3".
+func parseRemovedPeer(resp string) (int, error) {
+	fields := strings.Fields(resp)
+	if len(fields) == 0 {
+		return 0, errors.New("empty response of peer removal")
+	}
+	reclaimed, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, errors.Errorf("unexpected response of peer removal: %s", strings.TrimSpace(resp))
+	}
+	return reclaimed, nil
+}
@@ -0,0 +1,77 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testRemovePeerStatus = `5e:a4:e5:b8:d1:b6(host1)
+   -> 192.168.0.2:6783      aa:aa:aa:aa:aa:02(host2)            established
+   -> 192.168.0.3:6783      aa:aa:aa:aa:aa:03(host3)            failed
+aa:aa:aa:aa:aa:02(host2)
+   <- 192.168.0.1:43210     5e:a4:e5:b8:d1:b6(host1)            established
+`
+
+func newRemovePeerRouter(t *testing.T, overview string, removed *[]string) *Weave {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, overview)
+	})
+	mux.HandleFunc("/status/peers", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, testRemovePeerStatus)
+	})
+	mux.HandleFunc("/peer/", func(rw http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodDelete, r.Method)
+		peer := strings.TrimPrefix(r.URL.Path, "/peer/")
+		*removed = append(*removed, peer)
+		fmt.Fprintf(rw, "1024 IPs taken over from %s\n", peer)
+	})
+	return newFakeRouter(t, mux)
+}
+
+func TestWeave_RemovePeer(t *testing.T) {
+	var removed []string
+	w := newRemovePeerRouter(t, testOverviewStatus, &removed)
+
+	removals, err := w.RemovePeer(context.Background(), RemovePeerOptions{}, "host3")
+	require.NoError(t, err)
+	require.Equal(t, []PeerRemoval{{Peer: "host3", Node: w.address, Reclaimed: 1024}}, removals)
+
+	for _, peer := range []string{"host1", "5e:a4:e5:b8:d1:b6", "host2", "AA:AA:AA:AA:AA:02"} {
+		_, err = w.RemovePeer(context.Background(), RemovePeerOptions{}, peer)
+		require.Error(t, err, peer)
+	}
+	require.Equal(t, []string{"host3"}, removed)
+
+	_, err = w.RemovePeer(context.Background(), RemovePeerOptions{Force: true}, "host2")
+	require.NoError(t, err)
+	require.Equal(t, []string{"host3", "host2"}, removed)
+}
+
+func TestRemovePeerFromCluster(t *testing.T) {
+	var removedOn1, removedOn2 []string
+	node1 := newRemovePeerRouter(t, testOverviewStatus, &removedOn1)
+	node2 := newRemovePeerRouter(t, strings.Replace(testOverviewStatus, "5e:a4:e5:b8:d1:b6(host1)", "aa:aa:aa:aa:aa:02(host2)", 1), &removedOn2)
+
+	removals, err := RemovePeerFromCluster(context.Background(), []*Weave{node1, node2}, "host3")
+	require.NoError(t, err)
+	require.Len(t, removals, 1)
+	require.Equal(t, []string{"host3"}, removedOn1)
+	require.Empty(t, removedOn2)
+
+	// host2 is reachable from host1
+	_, err = RemovePeerFromCluster(context.Background(), []*Weave{node2, node1}, "host2")
+	require.Error(t, err)
+}
+
+func TestParseRemovedPeer(t *testing.T) {
+	n, err := parseRemovedPeer("256 IPs taken over from aa:aa:aa:aa:aa:03\n")
+	require.NoError(t, err)
+	require.Equal(t, 256, n)
+	_, err = parseRemovedPeer("not found")
+	require.Error(t, err)
+}
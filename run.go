@@ -0,0 +1,91 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+// RunContainer creates and starts a container on the weave network like
+// `weave run`. The container resolves with weaveDNS, a container without a
+// hostname is named after name in the weaveDNS domain. It is attached with
+// opts right after it starts and its name is registered in weaveDNS. When a
+// step fails the addresses and names are released and the container is
+// removed. config and hostConfig are not modified.
+func (w *Weave) RunContainer(ctx context.Context, config *container.Config, hostConfig *container.HostConfig,
+	name string, opts AttachOptions) (*AddressResult, error) {
+	if config == nil {
+		return nil, errors.New("container config is required")
+	}
+	runConfig := *config
+	config = &runConfig
+	runHostConfig := container.HostConfig{}
+	if hostConfig != nil {
+		runHostConfig = *hostConfig
+	}
+	hostConfig = &runHostConfig
+	if hostConfig.NetworkMode.IsHost() || hostConfig.NetworkMode.IsContainer() || hostConfig.NetworkMode.IsNone() {
+		return nil, errors.Errorf("a container with network mode %s can not be attached to weave", hostConfig.NetworkMode)
+	}
+	withDNS := !opts.WithoutDNS && !w.dns.Disabled
+	if withDNS {
+		dnsArgs, err := w.dns.dnsArgs()
+		if err != nil {
+			return nil, err
+		}
+		dnsArgs.ApplyHostConfig(hostConfig)
+		if config.Hostname == "" && name != "" {
+			domain, err := w.dns.domain()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := ParseDNSName(name); err != nil {
+				return nil, errors.Wrapf(err, "container name %s is no valid hostname", name)
+			}
+			config.Hostname, config.Domainname = name, domain.String()
+		}
+	}
+
+	resp, err := w.dockerCli.ContainerCreate(ctx, config, hostConfig, nil, nil, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.dockerCli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return nil, w.rollbackRun(resp.ID, err)
+	}
+	opts.WithoutDNS = !withDNS
+	result, err := w.Attach(resp.ID, opts)
+	if err != nil {
+		return nil, w.rollbackRun(resp.ID, err)
+	}
+	return result, nil
+}
+
+// rollbackRun releases the addresses and names of the container and removes
+// it, cause is returned with the errors of the rollback.
+func (w *Weave) rollbackRun(containerId string, cause error) error {
+	ctx := context.Background()
+	var failed []string
+	if !w.dns.Disabled {
+		if err := w.dns.removeWeaveDNS(containerId, "", "", false); err != nil {
+			failed = append(failed, fmt.Sprintf("remove dns names: %s", err))
+		}
+	}
+	if _, err := callWeaveContext(ctx, http.MethodDelete, fmt.Sprintf("http://%s:%d/ip/%s",
+		w.address, w.httpPort, containerId), nil); err != nil && !isHTTPNotFound(err) {
+		failed = append(failed, fmt.Sprintf("release addresses: %s", err))
+	}
+	if err := w.dockerCli.ContainerRemove(ctx, containerId, types.ContainerRemoveOptions{
+		RemoveVolumes: true,
+		Force:         true,
+	}); err != nil {
+		failed = append(failed, fmt.Sprintf("remove container: %s", err))
+	}
+	if len(failed) > 0 {
+		return errors.Wrapf(cause, "run container %s, rollback failed (%v)", containerId, failed)
+	}
+	return errors.Wrapf(cause, "run container %s", containerId)
+}
@@ -0,0 +1,95 @@
+package go_weave_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWeave_RunContainer(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	failIPAM, failAttach := false, false
+	mux := http.NewServeMux()
+	created := fakeWeaveExec(mux, func(cmd []string) (string, string, int) {
+		if len(cmd) > 1 && cmd[1] == "container-fqdn" {
+			return "web.weave.local\n", "", 0
+		}
+		if len(cmd) > 1 && cmd[1] == "attach-container" && failAttach {
+			return "", "unable to create the weave interface\n", 1
+		}
+		return "", "", 0
+	})
+	mux.HandleFunc("/ipinfo/tracker", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "ring")
+	})
+	record := func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/ip/") {
+			if failIPAM {
+				http.Error(rw, "range is full", http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(rw, "10.32.0.7/12")
+		}
+	}
+	mux.HandleFunc("/ip/", record)
+	mux.HandleFunc("/name/", record)
+	w := newFakeDockerRouter(t, mux)
+	w.dns.Address = "172.17.0.1:53"
+
+	config := &container.Config{Image: "nginx", Entrypoint: []string{"/app"}}
+	hostConfig := &container.HostConfig{}
+	result, err := w.RunContainer(context.Background(), config, hostConfig, "web", AttachOptions{})
+	require.NoError(t, err)
+	require.Empty(t, config.Hostname)
+	require.Empty(t, hostConfig.DNS)
+	require.Equal(t, "10.32.0.7/12", result.Addresses[0].String())
+	require.Equal(t, []string{
+		"POST /ip/" + result.ContainerId,
+		"PUT /name/" + result.ContainerId + "/10.32.0.7",
+	}, calls)
+
+	var request struct {
+		Hostname   string
+		Domainname string
+		HostConfig container.HostConfig
+	}
+	require.NoError(t, json.Unmarshal(created("web"), &request))
+	require.Equal(t, "web", request.Hostname)
+	require.Equal(t, "weave.local", request.Domainname)
+	require.Equal(t, []string{"172.17.0.1"}, request.HostConfig.DNS)
+	require.Equal(t, []string{"weave.local."}, request.HostConfig.DNSSearch)
+
+	// a failed attach releases the names and addresses of the container
+	calls, failIPAM = nil, true
+	_, err = w.RunContainer(context.Background(), &container.Config{Image: "nginx", Entrypoint: []string{"/app"}},
+		nil, "db", AttachOptions{Addresses: []AddressSpec{DefaultSubnet()}})
+	require.Error(t, err)
+	require.Len(t, calls, 3)
+	require.True(t, strings.HasPrefix(calls[0], "POST /ip/"), calls[0])
+	id := strings.TrimPrefix(calls[0], "POST /ip/")
+	require.Equal(t, []string{"DELETE /name/" + id, "DELETE /ip/" + id}, calls[1:])
+
+	// so does a failed attach-container
+	calls, failIPAM, failAttach = nil, false, true
+	_, err = w.RunContainer(context.Background(), &container.Config{Image: "nginx", Entrypoint: []string{"/app"}},
+		nil, "cache", AttachOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to create the weave interface")
+	require.Len(t, calls, 3)
+	id = strings.TrimPrefix(calls[0], "POST /ip/")
+	require.Equal(t, []string{"DELETE /name/" + id, "DELETE /ip/" + id}, calls[1:])
+
+	_, err = w.RunContainer(context.Background(), &container.Config{Image: "nginx"},
+		&container.HostConfig{NetworkMode: "host"}, "host", AttachOptions{})
+	require.Error(t, err)
+}
@@ -0,0 +1,89 @@
+package go_weave_api
+
+import (
+	"context"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// SelectorOptions are the options of AttachSelector and DetachSelector,
+// DetachSelector only uses Addresses and Concurrency.
+type SelectorOptions struct {
+	AttachOptions
+	// Concurrency is the number of containers handled in parallel,
+	// DefaultIPAMConcurrency when it is not positive
+	Concurrency int
+}
+
+// ContainerResult is the result of attaching or detaching one container of a
+// selector, Err is set when it failed.
+type ContainerResult struct {
+	ContainerId string
+	Name        string
+	Result      *AddressResult
+	Err         error
+}
+
+// AttachSelector attaches the running containers of the node's docker daemon
+// which match the docker filters, e.g. label=app=web or name=web. A failed
+// container does not stop the others, the error is only returned when the
+// containers can not be listed.
+func (w *Weave) AttachSelector(ctx context.Context, f filters.Args, opts SelectorOptions) ([]ContainerResult, error) {
+	results, err := w.selectContainers(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) > 1 {
+		for _, spec := range opts.Addresses {
+			if spec.IsStaticIP() {
+				return nil, errors.Errorf("the static ip %s can not be attached to %d containers", spec, len(results))
+			}
+		}
+	}
+	runConcurrent(opts.Concurrency, len(results), func(i int) {
+		if ctx.Err() != nil {
+			results[i].Err = ctx.Err()
+			return
+		}
+		results[i].Result, results[i].Err = w.Attach(results[i].ContainerId, opts.AttachOptions)
+	})
+	return results, nil
+}
+
+// DetachSelector detaches the running containers matching the docker filters
+// from opts.Addresses, from all their addresses when it is empty.
+func (w *Weave) DetachSelector(ctx context.Context, f filters.Args, opts SelectorOptions) ([]ContainerResult, error) {
+	results, err := w.selectContainers(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	runConcurrent(opts.Concurrency, len(results), func(i int) {
+		if ctx.Err() != nil {
+			results[i].Err = ctx.Err()
+			return
+		}
+		results[i].Result, results[i].Err = w.Detach(results[i].ContainerId, opts.Addresses...)
+	})
+	return results, nil
+}
+
+func (w *Weave) selectContainers(ctx context.Context, f filters.Args) ([]ContainerResult, error) {
+	if f.Len() == 0 {
+		return nil, errors.New("a selector needs at least one filter")
+	}
+	containers, err := w.dockerCli.ContainerList(ctx, types.ContainerListOptions{Filters: f})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]ContainerResult, 0, len(containers))
+	for _, ctr := range containers {
+		var name string
+		if len(ctr.Names) > 0 {
+			name = strings.TrimPrefix(ctr.Names[0], "/")
+		}
+		results = append(results, ContainerResult{ContainerId: ctr.ID, Name: name})
+	}
+	return results, nil
+}
@@ -0,0 +1,69 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWeave_AttachSelector(t *testing.T) {
+	var mu sync.Mutex
+	var attached []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1.41/containers/json", func(rw http.ResponseWriter, r *http.Request) {
+		require.Contains(t, r.URL.Query().Get("filters"), "app=web")
+		fmt.Fprint(rw, `[{"Id":"90440c9f28af","Names":["/web1"]},{"Id":"4d1b2c3e4f5a","Names":["/web2"]}]`)
+	})
+	fakeWeaveExec(mux, func(cmd []string) (string, string, int) {
+		switch cmd[1] {
+		case "attach-container":
+			mu.Lock()
+			attached = append(attached, cmd[2])
+			mu.Unlock()
+		case "container-fqdn":
+			return cmd[2] + ".weave.local\n", "", 0
+		}
+		return "", "", 0
+	})
+	mux.HandleFunc("/ipinfo/tracker", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, "ring")
+	})
+	mux.HandleFunc("/ip/", func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/ip/90440c9f28af"):
+			fmt.Fprint(rw, "10.44.0.1/24")
+		case strings.HasPrefix(r.URL.Path, "/ip/4d1b2c3e4f5a"):
+			http.Error(rw, "range is full", http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/name/", func(rw http.ResponseWriter, r *http.Request) {})
+	w := newFakeDockerRouter(t, mux)
+
+	f := filters.NewArgs(filters.Arg("label", "app=web"))
+	results, err := w.AttachSelector(context.Background(), f, SelectorOptions{
+		AttachOptions: AttachOptions{Addresses: []AddressSpec{Subnet("10.44.0.0/24")}},
+		Concurrency:   2,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "web1", results[0].Name)
+	require.NoError(t, results[0].Err)
+	require.Equal(t, "10.44.0.1/24", results[0].Result.Addresses[0].String())
+	require.Equal(t, "web2", results[1].Name)
+	require.Error(t, results[1].Err)
+	require.Nil(t, results[1].Result)
+	require.Equal(t, []string{"90440c9f28af"}, attached)
+
+	_, err = w.AttachSelector(context.Background(), f, SelectorOptions{
+		AttachOptions: AttachOptions{Addresses: []AddressSpec{StaticIP("10.44.0.9/24")}},
+	})
+	require.Error(t, err)
+
+	_, err = w.DetachSelector(context.Background(), filters.NewArgs(), SelectorOptions{})
+	require.Error(t, err)
+}
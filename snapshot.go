@@ -0,0 +1,228 @@
+package go_weave_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".json"
+)
+
+// Snapshot is the full status and the raw report of a router at one time.
+type Snapshot struct {
+	Time   time.Time       `json:"time"`
+	Status *Status         `json:"status"`
+	Report json.RawMessage `json:"report,omitempty"`
+}
+
+// ConnectionCount is the number of connections of a router at one time.
+type ConnectionCount struct {
+	Time        time.Time
+	Established int
+	Total       int
+}
+
+// Report returns the json report of the router, it holds more details than
+// the status, e.g. the ipam ring and the dns entries of every peer.
+func (w *Weave) Report(ctx context.Context) (json.RawMessage, error) {
+	return callWeaveContext(ctx, http.MethodGet, fmt.Sprintf("http://%s:%d/report", w.address, w.httpPort), nil)
+}
+
+// Snapshot takes a snapshot of the status and the report of the router.
+func (w *Weave) Snapshot(ctx context.Context) (*Snapshot, error) {
+	status, err := w.fullStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report, err := w.Report(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Time: time.Now(), Status: status, Report: report}, nil
+}
+
+// DiffSnapshots returns the changes from snapshot a to snapshot b.
+func DiffSnapshots(a, b *Snapshot) []Event {
+	return diffStatus(a.Status, b.Status, b.Time)
+}
+
+// SnapshotStore keeps snapshots as json files in a directory, one file per
+// snapshot named after its time.
+type SnapshotStore struct {
+	dir string
+	// retention is the max number of snapshots kept, 0 keeps all of them
+	retention int
+}
+
+func NewSnapshotStore(dir string, retention int) (*SnapshotStore, error) {
+	if retention < 0 {
+		return nil, errors.New("snapshot retention must not be negative")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &SnapshotStore{dir: dir, retention: retention}, nil
+}
+
+// Save writes the snapshot and removes the oldest snapshots beyond the retention.
+func (s *SnapshotStore) Save(snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path(snapshot.Time), data); err != nil {
+		return err
+	}
+
+	if s.retention == 0 {
+		return nil
+	}
+	times, err := s.List()
+	if err != nil {
+		return err
+	}
+	for len(times) > s.retention {
+		if err := os.Remove(s.path(times[0])); err != nil {
+			return err
+		}
+		times = times[1:]
+	}
+	return nil
+}
+
+// List returns the times of all stored snapshots, oldest first.
+func (s *SnapshotStore) List() ([]time.Time, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var times []time.Time
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		nanos, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		times = append(times, time.Unix(0, nanos))
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times, nil
+}
+
+// Load reads the snapshot taken at t.
+func (s *SnapshotStore) Load(t time.Time) (*Snapshot, error) {
+	data, err := os.ReadFile(s.path(t))
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, errors.Wrapf(err, "invalid snapshot %s", s.path(t))
+	}
+	return snapshot, nil
+}
+
+// At returns the latest snapshot taken at or before t, nil if there is none.
+func (s *SnapshotStore) At(t time.Time) (*Snapshot, error) {
+	times, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	i := sort.Search(len(times), func(i int) bool { return times[i].After(t) })
+	if i == 0 {
+		return nil, nil
+	}
+	return s.Load(times[i-1])
+}
+
+// Range returns the snapshots taken between from and to, both included, oldest first.
+func (s *SnapshotStore) Range(from, to time.Time) ([]*Snapshot, error) {
+	times, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []*Snapshot
+	for _, t := range times {
+		if t.Before(from) || t.After(to) {
+			continue
+		}
+		snapshot, err := s.Load(t)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// PeerLostAt returns the time of the first snapshot in which the peer was
+// missing after it had been present in the previous one, the latest of such
+// disappearances is returned. The peer is matched by node id, name or nickname.
+func (s *SnapshotStore) PeerLostAt(peer string) (time.Time, bool, error) {
+	snapshots, err := s.Range(time.Time{}, time.Now())
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	var lostAt time.Time
+	found := false
+	for i := 1; i < len(snapshots); i++ {
+		if hasPeer(snapshots[i-1].Status, peer) && !hasPeer(snapshots[i].Status, peer) {
+			lostAt = snapshots[i].Time
+			found = true
+		}
+	}
+	return lostAt, found, nil
+}
+
+// ConnectionCounts returns the number of connections in each snapshot taken
+// between from and to.
+func (s *SnapshotStore) ConnectionCounts(from, to time.Time) ([]ConnectionCount, error) {
+	snapshots, err := s.Range(from, to)
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]ConnectionCount, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		count := ConnectionCount{Time: snapshot.Time}
+		if snapshot.Status != nil {
+			count.Total = len(snapshot.Status.Connections)
+			for _, conn := range snapshot.Status.Connections {
+				if conn.State == "established" {
+					count.Established++
+				}
+			}
+		}
+		counts = append(counts, count)
+	}
+	return counts, nil
+}
+
+func (s *SnapshotStore) path(t time.Time) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%d%s", snapshotPrefix, t.UnixNano(), snapshotSuffix))
+}
+
+func hasPeer(status *Status, peer string) bool {
+	if status == nil {
+		return false
+	}
+	for _, p := range status.Peers {
+		if p.NodeId == peer || p.Name == peer || (p.Nickname != "" && p.Nickname == peer) {
+			return true
+		}
+	}
+	return false
+}
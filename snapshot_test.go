@@ -0,0 +1,94 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewSnapshotStore(dir, 3)
+	require.NoError(t, err)
+
+	base := time.Unix(1660000000, 0)
+	peers := []PeerStatus{{NodeId: "aa:aa:aa:aa:aa:01(host1)", Name: "aa:aa:aa:aa:aa:01", Nickname: "host1"},
+		{NodeId: "aa:aa:aa:aa:aa:02(host2)", Name: "aa:aa:aa:aa:aa:02", Nickname: "host2"}}
+	for i := 0; i < 4; i++ {
+		status := &Status{Peers: peers, Targets: TargetStatus{targets: []string{"192.168.0.2"}}}
+		status.Connections = []ConnectionStatus{{Outbound: true, Address: "192.168.0.2:6783", State: "established"}}
+		if i >= 2 {
+			status.Peers = peers[:1]
+			status.Connections[0].State = "failed"
+		}
+		require.NoError(t, store.Save(&Snapshot{Time: base.Add(time.Duration(i) * time.Hour), Status: status}))
+	}
+
+	// the oldest snapshot is removed by the retention
+	times, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, times, 3)
+	require.True(t, base.Add(time.Hour).Equal(times[0]))
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+
+	snapshot, err := store.At(base.Add(150 * time.Minute))
+	require.NoError(t, err)
+	require.True(t, base.Add(2*time.Hour).Equal(snapshot.Time))
+	require.Equal(t, []string{"192.168.0.2"}, snapshot.Status.Targets.targets)
+
+	snapshot, err = store.At(base)
+	require.NoError(t, err)
+	require.Nil(t, snapshot)
+
+	lostAt, found, err := store.PeerLostAt("host2")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.True(t, base.Add(2*time.Hour).Equal(lostAt))
+	_, found, err = store.PeerLostAt("host1")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	counts, err := store.ConnectionCounts(base, base.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, counts, 2)
+	require.Equal(t, 1, counts[0].Established)
+	require.Equal(t, 0, counts[1].Established)
+	require.Equal(t, 1, counts[1].Total)
+
+	snapshots, err := store.Range(base, base.Add(3*time.Hour))
+	require.NoError(t, err)
+	events := DiffSnapshots(snapshots[0], snapshots[1])
+	require.Len(t, events, 2)
+	require.Equal(t, EventPeerLost, events[0].Type)
+	require.Equal(t, EventConnectionStateChanged, events[1].Type)
+
+	// unrelated files are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644))
+	times, err = store.List()
+	require.NoError(t, err)
+	require.Len(t, times, 3)
+}
+
+func TestWeave_Snapshot(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, testOverviewStatus)
+	})
+	mux.HandleFunc("/status/", func(rw http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/report", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, `{"Version":"2.8.1"}`)
+	})
+	w := newFakeRouter(t, mux)
+
+	snapshot, err := w.Snapshot(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "2.8.1", snapshot.Status.Overview.Version)
+	require.JSONEq(t, `{"Version":"2.8.1"}`, string(snapshot.Report))
+}
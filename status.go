@@ -1,8 +1,11 @@
 package go_weave_api
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -47,7 +50,17 @@ type Overview struct {
 }
 
 type IPAMStatus struct {
-	IPAM string
+	IPAM  string
+	Peers []IPAMPeer
+}
+
+// IPAMPeer is the share of the allocation range owned by one peer.
+type IPAMPeer struct {
+	NodeId      string
+	Addresses   int
+	Percentage  float64
+	Active      int
+	Unreachable bool
 }
 
 type ConnectionStatus struct {
@@ -56,6 +69,17 @@ type ConnectionStatus struct {
 	State    string
 	Info     string
 	Attrs    map[string]any
+	// RemoteName and RemoteNickname identify the peer at the other end,
+	// they are empty until the connection has been set up
+	RemoteName     string
+	RemoteNickname string
+	Encrypted      bool
+	MTU            int
+	// Datapath is "fastdp" or "sleeve" for established connections
+	Datapath string
+	// FailureReason is the cause of a failed or retrying connection without
+	// the dial details and the retry time, e.g. "connection refused"
+	FailureReason string
 }
 
 type DNSStatus struct {
@@ -67,29 +91,47 @@ type DNSStatus struct {
 
 type PeerStatus struct {
 	NodeId      string
+	Name        string
+	Nickname    string
 	Connections []Connection
 }
 
 type Connection struct {
-	Outbound bool
-	Address  string
-	State    string
-	NodeId   string
+	Outbound       bool
+	Address        string
+	State          string
+	NodeId         string
+	RemoteName     string
+	RemoteNickname string
 }
 
 type TargetStatus struct {
 	targets []string
 }
 
+func (t TargetStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.targets)
+}
+
+func (t *TargetStatus) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &t.targets)
+}
+
 func (w *Weave) Status(subArgs ...string) (*Status, error) {
 	var subStatus string
-	statusUrl := fmt.Sprintf("http://%s:%d/status", w.address, w.httpPort)
 	if len(subArgs) > 0 {
 		subStatus = subArgs[0]
+	}
+	return w.status(context.Background(), subStatus)
+}
+
+func (w *Weave) status(ctx context.Context, subStatus string) (*Status, error) {
+	statusUrl := fmt.Sprintf("http://%s:%d/status", w.address, w.httpPort)
+	if subStatus != "" {
 		statusUrl = fmt.Sprintf("%s/%s", statusUrl, subStatus)
 	}
 
-	statusBytes, err := callWeave(http.MethodGet, statusUrl, nil)
+	statusBytes, err := callWeaveContext(ctx, http.MethodGet, statusUrl, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -114,6 +156,38 @@ func (w *Weave) Status(subArgs ...string) (*Status, error) {
 	return status, nil
 }
 
+// fullStatus queries the overview and every sub status of the router and
+// merges them into one Status. The dns status is skipped when weaveDNS is disabled.
+func (w *Weave) fullStatus(ctx context.Context) (*Status, error) {
+	full, err := w.status(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	subStatuses := []string{"connections", "peers", "targets", "ipam"}
+	if !w.dns.Disabled {
+		subStatuses = append(subStatuses, "dns")
+	}
+	for _, sub := range subStatuses {
+		status, err := w.status(ctx, sub)
+		if err != nil {
+			return nil, err
+		}
+		switch sub {
+		case "dns":
+			full.DNS = status.DNS
+		case "connections":
+			full.Connections = status.Connections
+		case "peers":
+			full.Peers = status.Peers
+		case "targets":
+			full.Targets = status.Targets
+		case "ipam":
+			full.IPAM = status.IPAM
+		}
+	}
+	return full, nil
+}
+
 func parseDNSStatus(data []byte) []DNSStatus {
 	dnsSlice := strings.Split(string(data), "\n")
 	if len(dnsSlice) == 0 {
@@ -147,40 +221,81 @@ func parseConnectionStatus(data []byte) []ConnectionStatus {
 
 	var connStatus []ConnectionStatus
 	for _, s := range connSlice {
-		if s == "" {
-			continue
-		}
 		connArgs := strings.Split(s, " ")
 		connArgs = removeSpaceElement(connArgs)
+		if len(connArgs) < 3 {
+			continue
+		}
 
 		status := ConnectionStatus{
 			Outbound: connArgs[0] == "->",
 			Address:  connArgs[1],
 			State:    connArgs[2],
+			Info:     strings.Join(connArgs[3:], " "),
 		}
-		i := 3
-		for ; i < len(connArgs); i++ {
-			if strings.Contains(connArgs[i], "=") {
-				break
+		parseConnectionInfo(&status, connArgs[3:])
+
+		connStatus = append(connStatus, status)
+
+	}
+	return connStatus
+}
+
+// parseConnectionInfo fills the typed fields of a connection from the words
+// after its state, e.g.
+//
+//	encrypted   fastdp 3a:8c:e4:ba:50:ee(host2) encrypted=true mtu=1376
+//	dial tcp 192.168.0.113:6783: connect: connection refused, retry: 2022-09-01 10:00:00
+func parseConnectionInfo(status *ConnectionStatus, infoArgs []string) {
+	if status.State == "failed" || status.State == "retrying" {
+		status.FailureReason = normalizeFailureReason(status.Info)
+		return
+	}
+
+	for _, arg := range infoArgs {
+		if key, value, found := strings.Cut(arg, "="); found {
+			if status.Attrs == nil {
+				status.Attrs = make(map[string]any)
 			}
-			status.Info = status.Info + connArgs[i] + " "
+			status.Attrs[key] = value
+			switch key {
+			case "mtu":
+				status.MTU, _ = strconv.Atoi(value)
+			case "encrypted":
+				status.Encrypted = value == "true"
+			}
+			continue
 		}
-
-		if i < len(connArgs)-1 {
-			attrs := make(map[string]any)
-			for i := 5; i < len(connArgs); i++ {
-				if strings.Contains(connArgs[i], "=") {
-					args := strings.Split(connArgs[i], "=")
-					attrs[args[0]] = args[1]
-				}
+		switch arg {
+		case "encrypted":
+			status.Encrypted = true
+		case "unencrypted":
+			status.Encrypted = false
+		case "fastdp", "sleeve":
+			status.Datapath = arg
+		default:
+			if strings.HasSuffix(arg, ")") && strings.Contains(arg, "(") {
+				status.RemoteName, status.RemoteNickname = parsePeerName(arg)
 			}
-			status.Attrs = attrs
 		}
+	}
+}
 
-		connStatus = append(connStatus, status)
+func normalizeFailureReason(info string) string {
+	reason, _, _ := strings.Cut(info, ", retry: ")
+	if i := strings.LastIndex(reason, ": "); i >= 0 {
+		reason = reason[i+2:]
+	}
+	return strings.ToLower(strings.TrimSpace(reason))
+}
 
+// parsePeerName splits "ce:31:e0:06:45:1a(host1)" into the peer name and nickname
+func parsePeerName(nodeId string) (string, string) {
+	name, nickname, found := strings.Cut(nodeId, "(")
+	if !found {
+		return nodeId, ""
 	}
-	return connStatus
+	return name, strings.TrimSuffix(nickname, ")")
 }
 
 func parseTargetStatus(data []byte) *TargetStatus {
@@ -197,46 +312,99 @@ func parseTargetStatus(data []byte) *TargetStatus {
 func parseIPAMStatus(data []byte) *IPAMStatus {
 	ipamArgs := strings.Split(string(data), "\n")
 
-	return &IPAMStatus{
+	status := &IPAMStatus{
 		IPAM: ipamArgs[0],
 	}
+	// ce:31:e0:06:45:1a(host1)     349526 IPs (33.3% of total) (1 active)
+	// f6:07:80:14:67:d3(host3)     349525 IPs (33.3% of total) - unreachable!
+	for _, line := range ipamArgs {
+		args := removeSpaceElement(strings.Split(strings.TrimSpace(line), " "))
+		if len(args) < 3 || args[2] != "IPs" {
+			continue
+		}
+		peer := IPAMPeer{NodeId: args[0], Unreachable: strings.Contains(line, "unreachable")}
+		peer.Addresses, _ = strconv.Atoi(args[1])
+		if len(args) > 3 {
+			peer.Percentage, _ = strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(args[3], "("), "%"), 64)
+		}
+		if _, active, found := strings.Cut(line, "of total) ("); found {
+			peer.Active, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(active), " active)"))
+		}
+		status.Peers = append(status.Peers, peer)
+	}
+	return status
 }
 
 func parseOverviewStatus(data []byte) *Overview {
-	overviewArgs := strings.Split(string(data), "\n")
-	overviewArgs = removeSpaceElement(overviewArgs)
-
 	overview := &Overview{}
-	args := strings.Split(overviewArgs[0], " ")
-	args = removeSpaceElement(args)
-	overview.Version = args[1]
-
-	var values []string
-	for i := 1; i < len(overviewArgs); i++ {
-		if strings.Contains(overviewArgs[i], "service") {
+	// the overview is a list of "key: value" lines grouped by "Service: xxx"
+	// headers, services which are not running are missing from the output
+	var service string
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Version":
+			overview.Version, _, _ = strings.Cut(value, " ")
+			continue
+		case "Service":
+			service, _, _ = strings.Cut(value, " ")
 			continue
 		}
-		args := strings.Split(overviewArgs[i], ":")
-		values = append(values, strings.TrimSpace(args[1]))
-	}
 
-	overview.Router.Protocol = values[0]
-	overview.Router.Name = values[1]
-	overview.Router.Encryption = values[2]
-	overview.Router.PeerDiscovery = values[3]
-	overview.Router.Targets = values[4]
-	overview.Router.Connections = values[5]
-	overview.Router.Peers = values[6]
-	overview.Router.TrustedSubnets = values[7]
-	overview.IPAM.Status = values[8]
-	overview.IPAM.Range = values[9]
-	overview.IPAM.DefaultSubnet = values[10]
-	overview.DNS.Domain = values[11]
-	overview.DNS.Upstream = values[12]
-	overview.DNS.TTL = values[13]
-	overview.DNS.Entries = values[14]
-	overview.Proxy.Address = values[15]
-	overview.Plugin.DriverName = values[16]
+		switch service {
+		case "router":
+			switch key {
+			case "Protocol":
+				overview.Router.Protocol = value
+			case "Name":
+				overview.Router.Name = value
+			case "Encryption":
+				overview.Router.Encryption = value
+			case "PeerDiscovery":
+				overview.Router.PeerDiscovery = value
+			case "Targets":
+				overview.Router.Targets = value
+			case "Connections":
+				overview.Router.Connections = value
+			case "Peers":
+				overview.Router.Peers = value
+			case "TrustedSubnets":
+				overview.Router.TrustedSubnets = value
+			}
+		case "ipam":
+			switch key {
+			case "Status":
+				overview.IPAM.Status = value
+			case "Range":
+				overview.IPAM.Range = value
+			case "DefaultSubnet":
+				overview.IPAM.DefaultSubnet = value
+			}
+		case "dns":
+			switch key {
+			case "Domain":
+				overview.DNS.Domain = value
+			case "Upstream":
+				overview.DNS.Upstream = value
+			case "TTL":
+				overview.DNS.TTL = value
+			case "Entries":
+				overview.DNS.Entries = value
+			}
+		case "proxy":
+			if key == "Address" {
+				overview.Proxy.Address = value
+			}
+		case "plugin":
+			if key == "DriverName" {
+				overview.Plugin.DriverName = value
+			}
+		}
+	}
 
 	return overview
 }
@@ -258,14 +426,19 @@ newStatus:
 				goto newStatus
 			}
 			status = PeerStatus{NodeId: peerSlice[i]}
+			status.Name, status.Nickname = parsePeerName(peerSlice[i])
 		} else {
 			args = removeSpaceElement(args)
+			if len(args) < 4 {
+				continue
+			}
 			conn := Connection{
 				Outbound: args[0] == "->",
 				Address:  args[1],
 				NodeId:   args[2],
 				State:    args[3],
 			}
+			conn.RemoteName, conn.RemoteNickname = parsePeerName(args[2])
 
 			status.Connections = append(status.Connections, conn)
 		}
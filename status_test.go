@@ -2,6 +2,11 @@ package go_weave_api
 
 import (
 	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -30,3 +35,114 @@ func TestWeave_Status(t *testing.T) {
 	require.NoError(t, err)
 	t.Log(status.Peers)
 }
+
+// newFakeRouter starts a http server which serves the given status pages and
+// returns a Weave pointing at it.
+func newFakeRouter(t *testing.T, handler http.Handler) *Weave {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	httpPort, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return &Weave{address: host, httpPort: httpPort, dns: &DNSServer{Search: "weave.local"}}
+}
+
+const testOverviewStatus = `
+        Version: 2.8.1 (up to date; next check at 2022/09/01 10:00:00)
+
+        Service: router
+       Protocol: weave 1..2
+           Name: 5e:a4:e5:b8:d1:b6(host1)
+     Encryption: disabled
+  PeerDiscovery: enabled
+        Targets: 1
+    Connections: 1 (1 established)
+          Peers: 2 (with 2 established connections)
+ TrustedSubnets: none
+
+        Service: ipam
+         Status: ready
+          Range: 10.32.0.0/12
+  DefaultSubnet: 10.32.0.0/12
+
+        Service: dns
+         Domain: weave.local.
+       Upstream: 8.8.8.8
+            TTL: 1
+        Entries: 2
+
+        Service: proxy
+        Address: unix:///var/run/weave/weave.sock
+
+        Service: plugin (legacy)
+     DriverName: weave
+`
+
+func TestParseOverviewStatus(t *testing.T) {
+	overview := parseOverviewStatus([]byte(testOverviewStatus))
+	require.Equal(t, "2.8.1", overview.Version)
+	require.Equal(t, "5e:a4:e5:b8:d1:b6(host1)", overview.Router.Name)
+	require.Equal(t, "disabled", overview.Router.Encryption)
+	require.Equal(t, "ready", overview.IPAM.Status)
+	require.Equal(t, "10.32.0.0/12", overview.IPAM.Range)
+	require.Equal(t, "weave.local.", overview.DNS.Domain)
+	require.Equal(t, "unix:///var/run/weave/weave.sock", overview.Proxy.Address)
+	require.Equal(t, "weave", overview.Plugin.DriverName)
+
+	// a router launched with --no-dns has no dns service
+	dnsStart := strings.Index(testOverviewStatus, "        Service: dns")
+	dnsEnd := strings.Index(testOverviewStatus, "        Service: proxy")
+	noDNS := testOverviewStatus[:dnsStart] + testOverviewStatus[dnsEnd:]
+	overview = parseOverviewStatus([]byte(noDNS))
+	require.Equal(t, "", overview.DNS.Domain)
+	require.Equal(t, "weave", overview.Plugin.DriverName)
+}
+
+func TestParseConnectionStatus(t *testing.T) {
+	data := `-> 192.168.48.14:6783     established encrypted   fastdp f6:50:45:ba:df:9d(host3) encrypted=true mtu=1376
+<- 192.168.48.12:33866    established unencrypted sleeve 3a:8c:e4:ba:50:ee(host2) mtu=1438
+-> 192.168.48.15:6783     failed      dial tcp 192.168.48.15:6783: connect: connection refused, retry: 2022-09-01 10:00:00 +0000 UTC
+-> 192.168.48.16:6783     retrying    read tcp 192.168.48.11:43210->192.168.48.16:6783: i/o timeout
+`
+	conns := parseConnectionStatus([]byte(data))
+	require.Len(t, conns, 4)
+
+	require.True(t, conns[0].Outbound)
+	require.Equal(t, "f6:50:45:ba:df:9d", conns[0].RemoteName)
+	require.Equal(t, "host3", conns[0].RemoteNickname)
+	require.True(t, conns[0].Encrypted)
+	require.Equal(t, "fastdp", conns[0].Datapath)
+	require.Equal(t, 1376, conns[0].MTU)
+	require.Equal(t, "1376", conns[0].Attrs["mtu"])
+
+	require.False(t, conns[1].Outbound)
+	require.False(t, conns[1].Encrypted)
+	require.Equal(t, "sleeve", conns[1].Datapath)
+	require.Equal(t, 1438, conns[1].MTU)
+
+	require.Equal(t, "failed", conns[2].State)
+	require.Equal(t, "connection refused", conns[2].FailureReason)
+	require.Equal(t, "", conns[2].Datapath)
+	require.Equal(t, "i/o timeout", conns[3].FailureReason)
+}
+
+func TestParsePeerStatus(t *testing.T) {
+	data := `ce:31:e0:06:45:1a(host1)
+   <- 192.168.48.12:33866   3a:8c:e4:ba:50:ee(host2)            established
+   -> 192.168.48.13:6783    f6:50:45:ba:df:9d(host3)            pending
+3a:8c:e4:ba:50:ee(host2)
+   -> 192.168.48.11:6783    ce:31:e0:06:45:1a(host1)            established
+`
+	peers := parsePeerStatus([]byte(data))
+	require.Len(t, peers, 2)
+	require.Equal(t, "ce:31:e0:06:45:1a", peers[0].Name)
+	require.Equal(t, "host1", peers[0].Nickname)
+	require.Len(t, peers[0].Connections, 2)
+	require.Equal(t, "3a:8c:e4:ba:50:ee", peers[0].Connections[0].RemoteName)
+	require.Equal(t, "host2", peers[0].Connections[0].RemoteNickname)
+	require.Equal(t, "pending", peers[0].Connections[1].State)
+	require.Equal(t, "host2", peers[1].Nickname)
+}
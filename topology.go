@@ -0,0 +1,220 @@
+package go_weave_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Topology is the peer mesh as seen by one router, built from the peer status.
+type Topology struct {
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+}
+
+type TopologyNode struct {
+	Name     string `json:"name"`
+	Nickname string `json:"nickname,omitempty"`
+	// Reported is true when the peer status lists the node with its own
+	// connections, false when it is only known as a remote end
+	Reported bool `json:"reported"`
+}
+
+// TopologyEdge is a connection from one peer to another as reported by From.
+type TopologyEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Outbound bool   `json:"outbound"`
+	Address  string `json:"address,omitempty"`
+	State    string `json:"state,omitempty"`
+}
+
+// Topology queries the peer status of the router and builds the mesh topology.
+func (w *Weave) Topology(ctx context.Context) (*Topology, error) {
+	status, err := w.status(ctx, "peers")
+	if err != nil {
+		return nil, err
+	}
+	return NewTopology(status.Peers), nil
+}
+
+// NewTopology builds the topology from the peer status. Peers which are only
+// known as the remote end of a connection are added as nodes as well.
+func NewTopology(peers []PeerStatus) *Topology {
+	t := &Topology{}
+	nodes := make(map[string]int)
+	addNode := func(name, nickname string, reported bool) {
+		if i, ok := nodes[name]; ok {
+			if t.Nodes[i].Nickname == "" {
+				t.Nodes[i].Nickname = nickname
+			}
+			t.Nodes[i].Reported = t.Nodes[i].Reported || reported
+			return
+		}
+		nodes[name] = len(t.Nodes)
+		t.Nodes = append(t.Nodes, TopologyNode{Name: name, Nickname: nickname, Reported: reported})
+	}
+
+	for _, peer := range peers {
+		addNode(peer.Name, peer.Nickname, true)
+		for _, conn := range peer.Connections {
+			addNode(conn.RemoteName, conn.RemoteNickname, false)
+			t.Edges = append(t.Edges, TopologyEdge{
+				From:     peer.Name,
+				To:       conn.RemoteName,
+				Outbound: conn.Outbound,
+				Address:  conn.Address,
+				State:    conn.State,
+			})
+		}
+	}
+	return t
+}
+
+// DOT renders the topology in the graphviz dot language.
+func (t *Topology) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph weave {\n")
+	for _, node := range t.Nodes {
+		label := node.Name
+		if node.Nickname != "" {
+			label = fmt.Sprintf("%s\\n%s", node.Nickname, node.Name)
+		}
+		fmt.Fprintf(&b, "  %q [label=%q];\n", node.Name, label)
+	}
+	for _, edge := range t.Edges {
+		style := "solid"
+		if edge.State != "established" {
+			style = "dashed"
+		}
+		fmt.Fprintf(&b, "  %q -> %q [label=%q, style=%s];\n", edge.From, edge.To, edge.State, style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// JSON renders the topology as a list of nodes and a list of edges.
+func (t *Topology) JSON() ([]byte, error) {
+	return json.Marshal(t)
+}
+
+// Components returns the names of the peers in each connected component,
+// ignoring the direction and the state of the edges. A healthy mesh has one.
+func (t *Topology) Components() [][]string {
+	adjacent := make(map[string][]string)
+	for _, edge := range t.Edges {
+		adjacent[edge.From] = append(adjacent[edge.From], edge.To)
+		adjacent[edge.To] = append(adjacent[edge.To], edge.From)
+	}
+
+	visited := make(map[string]bool)
+	var components [][]string
+	for _, node := range t.Nodes {
+		if visited[node.Name] {
+			continue
+		}
+		var component []string
+		stack := []string{node.Name}
+		visited[node.Name] = true
+		for len(stack) > 0 {
+			name := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			component = append(component, name)
+			for _, next := range adjacent[name] {
+				if !visited[next] {
+					visited[next] = true
+					stack = append(stack, next)
+				}
+			}
+		}
+		sort.Strings(component)
+		components = append(components, component)
+	}
+	return components
+}
+
+// Reachable returns the names of the nodes reachable from the node name over
+// established connections, including name itself, sorted.
+func (t *Topology) Reachable(name string) []string {
+	adjacent := make(map[string][]string)
+	for _, edge := range t.Edges {
+		if edge.State != "established" {
+			continue
+		}
+		adjacent[edge.From] = append(adjacent[edge.From], edge.To)
+		adjacent[edge.To] = append(adjacent[edge.To], edge.From)
+	}
+	visited := map[string]bool{name: true}
+	reachable := []string{name}
+	stack := []string{name}
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, adj := range adjacent[next] {
+			if !visited[adj] {
+				visited[adj] = true
+				reachable = append(reachable, adj)
+				stack = append(stack, adj)
+			}
+		}
+	}
+	sort.Strings(reachable)
+	return reachable
+}
+
+// MissingEdges returns the connections a full mesh would have which are not
+// reported by any peer. Only the reported nodes are compared, each returned
+// edge has From sorted before To.
+func (t *Topology) MissingEdges() []TopologyEdge {
+	connected := make(map[[2]string]bool)
+	for _, edge := range t.Edges {
+		connected[[2]string{edge.From, edge.To}] = true
+		connected[[2]string{edge.To, edge.From}] = true
+	}
+
+	var names []string
+	for _, node := range t.Nodes {
+		if node.Reported {
+			names = append(names, node.Name)
+		}
+	}
+	sort.Strings(names)
+
+	var missing []TopologyEdge
+	for i := 0; i < len(names); i++ {
+		for j := i + 1; j < len(names); j++ {
+			if !connected[[2]string{names[i], names[j]}] {
+				missing = append(missing, TopologyEdge{From: names[i], To: names[j]})
+			}
+		}
+	}
+	return missing
+}
+
+// AsymmetricLinks returns the edges whose reverse edge is not reported by the
+// other peer, or is reported with a different state.
+func (t *Topology) AsymmetricLinks() []TopologyEdge {
+	reporters := make(map[string]bool)
+	for _, node := range t.Nodes {
+		reporters[node.Name] = node.Reported
+	}
+	states := make(map[[2]string]string)
+	for _, edge := range t.Edges {
+		states[[2]string{edge.From, edge.To}] = edge.State
+	}
+
+	var asymmetric []TopologyEdge
+	for _, edge := range t.Edges {
+		if !reporters[edge.To] {
+			// the peer at the other end did not report its connections
+			continue
+		}
+		state, ok := states[[2]string{edge.To, edge.From}]
+		if !ok || state != edge.State {
+			asymmetric = append(asymmetric, edge)
+		}
+	}
+	return asymmetric
+}
@@ -0,0 +1,50 @@
+package go_weave_api
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+const testPeerStatus = `aa:aa:aa:aa:aa:01(host1)
+   -> 192.168.0.2:6783      aa:aa:aa:aa:aa:02(host2)            established
+   -> 192.168.0.3:6783      aa:aa:aa:aa:aa:03(host3)            pending
+aa:aa:aa:aa:aa:02(host2)
+   <- 192.168.0.1:43210     aa:aa:aa:aa:aa:01(host1)            established
+aa:aa:aa:aa:aa:03(host3)
+aa:aa:aa:aa:aa:04(host4)
+   -> 192.168.0.5:6783      aa:aa:aa:aa:aa:05(host5)            established
+`
+
+func TestTopology(t *testing.T) {
+	topo := NewTopology(parsePeerStatus([]byte(testPeerStatus)))
+	require.Len(t, topo.Nodes, 5)
+	require.Len(t, topo.Edges, 4)
+	require.Equal(t, "host5", topo.Nodes[4].Nickname)
+
+	components := topo.Components()
+	require.Equal(t, [][]string{
+		{"aa:aa:aa:aa:aa:01", "aa:aa:aa:aa:aa:02", "aa:aa:aa:aa:aa:03"},
+		{"aa:aa:aa:aa:aa:04", "aa:aa:aa:aa:aa:05"},
+	}, components)
+
+	// host5 did not report its connections
+	missing := topo.MissingEdges()
+	require.Len(t, missing, 4)
+	require.Equal(t, TopologyEdge{From: "aa:aa:aa:aa:aa:01", To: "aa:aa:aa:aa:aa:04"}, missing[0])
+
+	asymmetric := topo.AsymmetricLinks()
+	require.Len(t, asymmetric, 1)
+	require.Equal(t, "aa:aa:aa:aa:aa:03", asymmetric[0].To)
+
+	dot := topo.DOT()
+	require.True(t, strings.HasPrefix(dot, "digraph weave {"))
+	require.Contains(t, dot, `"aa:aa:aa:aa:aa:01" -> "aa:aa:aa:aa:aa:03" [label="pending", style=dashed];`)
+
+	data, err := topo.JSON()
+	require.NoError(t, err)
+	var decoded Topology
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, *topo, decoded)
+}
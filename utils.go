@@ -9,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 	"math/rand"
 	"net"
+	"os"
 	"strings"
 	"time"
 )
@@ -92,3 +93,13 @@ func localhost(host string) bool {
 	return ip.IsLoopback()
 	//return host == "127.0.0.1" || host == "localhost"
 }
+
+// writeFileAtomic writes data to a temporary file first and renames it to
+// path, so a crash never leaves half a file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,201 @@
+package go_weave_api
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventPeerAdded              EventType = "peer-added"
+	EventPeerLost               EventType = "peer-lost"
+	EventConnectionAdded        EventType = "connection-added"
+	EventConnectionRemoved      EventType = "connection-removed"
+	EventConnectionStateChanged EventType = "connection-state-changed"
+	EventDNSAdded               EventType = "dns-added"
+	EventDNSRemoved             EventType = "dns-removed"
+	EventIPAMChanged            EventType = "ipam-changed"
+	EventVersionChanged         EventType = "version-changed"
+	// EventError is sent when a status poll fails, the watch keeps running
+	EventError EventType = "error"
+)
+
+// Event is a change between two successive status snapshots of a weave router.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Peer is the node id of the peer for peer events
+	Peer string
+	// Connection is the current connection for connection events, or the
+	// last known one when the connection is removed
+	Connection *ConnectionStatus
+	// DNS is the entry for dns events
+	DNS *DNSStatus
+	// OldValue and NewValue hold the connection state, the ipam status or
+	// the version before and after the change
+	OldValue string
+	NewValue string
+	Err      error
+}
+
+// Watch polls the status of the weave router every interval and sends the
+// changes between successive snapshots on the returned channel. The first
+// snapshot is taken before Watch returns, so an unreachable router is
+// reported as an error. The channel is closed when ctx is done.
+func (w *Weave) Watch(ctx context.Context, interval time.Duration) (<-chan Event, error) {
+	if interval <= 0 {
+		return nil, errors.New("watch interval must be positive")
+	}
+	prev, err := w.fullStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event, 64)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			cur, err := w.fullStatus(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if !sendEvent(ctx, events, Event{Type: EventError, Time: time.Now(), Err: err}) {
+					return
+				}
+				continue
+			}
+			for _, event := range diffStatus(prev, cur, time.Now()) {
+				if !sendEvent(ctx, events, event) {
+					return
+				}
+			}
+			prev = cur
+		}
+	}()
+
+	return events, nil
+}
+
+func sendEvent(ctx context.Context, events chan<- Event, event Event) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// diffStatus computes the events which turn the prev snapshot into cur.
+func diffStatus(prev, cur *Status, now time.Time) []Event {
+	var events []Event
+
+	prevVersion, curVersion := overviewVersion(prev), overviewVersion(cur)
+	if prevVersion != curVersion {
+		events = append(events, Event{Type: EventVersionChanged, Time: now,
+			OldValue: prevVersion, NewValue: curVersion})
+	}
+
+	prevIPAM, curIPAM := ipamState(prev), ipamState(cur)
+	if prevIPAM != curIPAM {
+		events = append(events, Event{Type: EventIPAMChanged, Time: now,
+			OldValue: prevIPAM, NewValue: curIPAM})
+	}
+
+	prevPeers := make(map[string]struct{}, len(prev.Peers))
+	for _, peer := range prev.Peers {
+		prevPeers[peer.NodeId] = struct{}{}
+	}
+	curPeers := make(map[string]struct{}, len(cur.Peers))
+	for _, peer := range cur.Peers {
+		curPeers[peer.NodeId] = struct{}{}
+		if _, ok := prevPeers[peer.NodeId]; !ok {
+			events = append(events, Event{Type: EventPeerAdded, Time: now, Peer: peer.NodeId})
+		}
+	}
+	for _, peer := range prev.Peers {
+		if _, ok := curPeers[peer.NodeId]; !ok {
+			events = append(events, Event{Type: EventPeerLost, Time: now, Peer: peer.NodeId})
+		}
+	}
+
+	prevConns := make(map[string]ConnectionStatus, len(prev.Connections))
+	for _, conn := range prev.Connections {
+		prevConns[connectionKey(conn)] = conn
+	}
+	curConns := make(map[string]struct{}, len(cur.Connections))
+	for i := range cur.Connections {
+		conn := cur.Connections[i]
+		key := connectionKey(conn)
+		curConns[key] = struct{}{}
+		old, ok := prevConns[key]
+		if !ok {
+			events = append(events, Event{Type: EventConnectionAdded, Time: now,
+				Connection: &conn, NewValue: conn.State})
+			continue
+		}
+		if old.State != conn.State {
+			events = append(events, Event{Type: EventConnectionStateChanged, Time: now,
+				Connection: &conn, OldValue: old.State, NewValue: conn.State})
+		}
+	}
+	for i := range prev.Connections {
+		conn := prev.Connections[i]
+		if _, ok := curConns[connectionKey(conn)]; !ok {
+			events = append(events, Event{Type: EventConnectionRemoved, Time: now,
+				Connection: &conn, OldValue: conn.State})
+		}
+	}
+
+	prevDNS := make(map[DNSStatus]struct{}, len(prev.DNS))
+	for _, entry := range prev.DNS {
+		prevDNS[entry] = struct{}{}
+	}
+	curDNS := make(map[DNSStatus]struct{}, len(cur.DNS))
+	for i := range cur.DNS {
+		entry := cur.DNS[i]
+		curDNS[entry] = struct{}{}
+		if _, ok := prevDNS[entry]; !ok {
+			events = append(events, Event{Type: EventDNSAdded, Time: now, DNS: &entry})
+		}
+	}
+	for i := range prev.DNS {
+		entry := prev.DNS[i]
+		if _, ok := curDNS[entry]; !ok {
+			events = append(events, Event{Type: EventDNSRemoved, Time: now, DNS: &entry})
+		}
+	}
+
+	return events
+}
+
+func connectionKey(conn ConnectionStatus) string {
+	if conn.Outbound {
+		return "->" + conn.Address
+	}
+	return "<-" + conn.Address
+}
+
+func overviewVersion(status *Status) string {
+	if status.Overview == nil {
+		return ""
+	}
+	return status.Overview.Version
+}
+
+func ipamState(status *Status) string {
+	if status.Overview != nil && status.Overview.IPAM.Status != "" {
+		return status.Overview.IPAM.Status
+	}
+	return status.IPAM.IPAM
+}
@@ -0,0 +1,91 @@
+package go_weave_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiffStatus(t *testing.T) {
+	prev := &Status{
+		Overview: &Overview{Version: "2.8.0"},
+		Peers:    []PeerStatus{{NodeId: "5e:a4:e5:b8:d1:b6(host1)"}, {NodeId: "3a:8c:e4:ba:50:ee(host2)"}},
+		Connections: []ConnectionStatus{
+			{Outbound: true, Address: "192.168.0.112:6783", State: "established"},
+			{Outbound: true, Address: "192.168.0.113:6783", State: "established"},
+		},
+		DNS: []DNSStatus{{Hostname: "box", Address: "10.32.0.1", ContainerId: "90440c9f28af", Origin: "5e:a4:e5:b8:d1:b6"}},
+	}
+	prev.Overview.IPAM.Status = "idle"
+	cur := &Status{
+		Overview: &Overview{Version: "2.8.1"},
+		Peers:    []PeerStatus{{NodeId: "5e:a4:e5:b8:d1:b6(host1)"}, {NodeId: "f6:50:45:ba:df:9d(host3)"}},
+		Connections: []ConnectionStatus{
+			{Outbound: true, Address: "192.168.0.112:6783", State: "failed"},
+			{Outbound: false, Address: "192.168.0.114:43210", State: "established"},
+		},
+		DNS: []DNSStatus{{Hostname: "box2", Address: "10.32.0.2", ContainerId: "90440c9f28af", Origin: "5e:a4:e5:b8:d1:b6"}},
+	}
+	cur.Overview.IPAM.Status = "ready"
+
+	now := time.Now()
+	events := diffStatus(prev, cur, now)
+
+	byType := make(map[EventType][]Event)
+	for _, event := range events {
+		require.Equal(t, now, event.Time)
+		byType[event.Type] = append(byType[event.Type], event)
+	}
+	require.Len(t, events, 9)
+	require.Equal(t, "2.8.0", byType[EventVersionChanged][0].OldValue)
+	require.Equal(t, "2.8.1", byType[EventVersionChanged][0].NewValue)
+	require.Equal(t, "ready", byType[EventIPAMChanged][0].NewValue)
+	require.Equal(t, "f6:50:45:ba:df:9d(host3)", byType[EventPeerAdded][0].Peer)
+	require.Equal(t, "3a:8c:e4:ba:50:ee(host2)", byType[EventPeerLost][0].Peer)
+	require.Equal(t, "established", byType[EventConnectionStateChanged][0].OldValue)
+	require.Equal(t, "failed", byType[EventConnectionStateChanged][0].NewValue)
+	require.Equal(t, "192.168.0.114:43210", byType[EventConnectionAdded][0].Connection.Address)
+	require.Equal(t, "192.168.0.113:6783", byType[EventConnectionRemoved][0].Connection.Address)
+	require.Equal(t, "box2", byType[EventDNSAdded][0].DNS.Hostname)
+	require.Equal(t, "box", byType[EventDNSRemoved][0].DNS.Hostname)
+
+	require.Empty(t, diffStatus(cur, cur, now))
+}
+
+func TestWeave_Watch(t *testing.T) {
+	var mu sync.Mutex
+	connState := "established"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(rw http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(rw, testOverviewStatus)
+	})
+	mux.HandleFunc("/status/connections", func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(rw, "-> 192.168.0.112:6783     %s fastdp 3a:8c:e4:ba:50:ee(host2) mtu=1376\n", connState)
+	})
+	mux.HandleFunc("/status/", func(rw http.ResponseWriter, r *http.Request) {})
+	w := newFakeRouter(t, mux)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := w.Watch(ctx, 10*time.Millisecond)
+	require.NoError(t, err)
+
+	mu.Lock()
+	connState = "failed"
+	mu.Unlock()
+
+	event := <-events
+	require.Equal(t, EventConnectionStateChanged, event.Type)
+	require.Equal(t, "established", event.OldValue)
+	require.Equal(t, "failed", event.NewValue)
+
+	cancel()
+	for range events {
+	}
+}
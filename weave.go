@@ -8,14 +8,15 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
 	docker "github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/pkg/errors"
-	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,12 +25,17 @@ const (
 	weaveHttpPort       = 6784
 	weaveStatusPort     = 6782
 	defaultWeaveVersion = "2.8.1"
+	fallbackResolvConf  = "/var/run/weave/fallback-resolv.conf"
 )
 
 type Weave struct {
 	dockerCli            *docker.Client
 	cni                  *CNIBuilder
 	dns                  *DNSServer
+	planner              *SubnetPlanner
+	awsvpc               bool
+	trackerMu            sync.Mutex
+	tracker              string
 	clientTLS            *tlsCerts
 	containerID          string
 	address              string
@@ -43,8 +49,9 @@ type Weave struct {
 	password             string
 	local                bool
 	version              string
+	versionSet           bool
 	tlsVerify            bool
-	ipAllocInit          string
+	ipAllocInits         []ipAllocInit
 	ipRange              string
 	ipAllocDefaultSubnet string
 	noDefaultIpAlloc     bool
@@ -95,6 +102,7 @@ func NewWeaveNode(address string, opts ...Option) (*Weave, error) {
 	for _, opt := range opts {
 		opt(w)
 	}
+	w.dns.weave = w
 	// create docker client
 	var dopts []docker.Opt
 	if w.local && localhost(address) {
@@ -137,6 +145,16 @@ func NewWeaveNode(address string, opts ...Option) (*Weave, error) {
 // ==================== network helper =====================
 
 func (w *Weave) Launch() error {
+	if err := w.validateIPAllocInit(); err != nil {
+		return err
+	}
+	if err := w.validateAWSVPC(); err != nil {
+		return err
+	}
+	if err := w.dns.validateFallback(); err != nil {
+		return err
+	}
+	w.resetTracker()
 	// 1. install cni plugin
 	if err := w.cni.installCNIPlugin(); err != nil {
 		return err
@@ -161,6 +179,7 @@ func (w *Weave) Launch() error {
 }
 
 func (w *Weave) Stop() error {
+	w.resetTracker()
 	result, err := w.runWeaveExec("remove-plugin-network", "weave")
 	if err != nil {
 		return err
@@ -294,7 +313,7 @@ func (w *Weave) createWeaveVolumeFrom() error {
 
 func (w *Weave) AddContainerDNS(containerId, fqdn string) error {
 	if w.dns.Disabled {
-		return errors.New("weaveDNS disabled")
+		return errDNSDisabled
 	}
 	ip, err := getContainerWeaveIP(w.dockerCli, containerId)
 	if err != nil {
@@ -307,41 +326,82 @@ func (w *Weave) AddContainerDNS(containerId, fqdn string) error {
 	return w.dns.addWeaveDNS(id, ip, fqdn, false)
 }
 
+// DNSArgs returns the dns settings for containers which should resolve weave
+// names, it is the equivalent of `weave dns-args`.
+func (w *Weave) DNSArgs() (*DNSArgs, error) {
+	return w.dns.dnsArgs()
+}
+
 func (w *Weave) AddExternalDNS(ip, fqdn string) error {
 	return w.dns.addWeaveDNS("", ip, fqdn, true)
 }
 
+// LookupDNS resolves hostname through weaveDNS and falls back to the
+// resolver of this host, it returns the addresses found.
 func (w *Weave) LookupDNS(hostname string) ([]string, error) {
-	// find dns from weave router,
-	// no dig command here
+	answers, err := w.LookupDNSRecords(context.Background(), hostname, DNSLookupWithFallback)
+	if err != nil {
+		return nil, err
+	}
 	var ips []string
-	if !w.dns.Disabled {
-		status, err := w.Status("dns")
+	for _, answer := range answers {
+		ips = append(ips, answer.IP.String())
+	}
+	return ips, nil
+}
+
+// LookupDNSRecords sends an A query for hostname to the weaveDNS listener of
+// the node. A hostname without dots is qualified with the weaveDNS domain.
+// With DNSLookupWithFallback the fallback resolvers of weaveDNS, or the
+// resolver of this host when there are none, are asked when weaveDNS is
+// disabled, unreachable or has no answer.
+func (w *Weave) LookupDNSRecords(ctx context.Context, hostname string, mode DNSLookupMode) ([]DNSAnswer, error) {
+	var weaveErr error
+	if w.dns.Disabled {
+		weaveErr = errDNSDisabled
+	} else {
+		fqdn, err := w.dns.qualify(hostname)
 		if err != nil {
 			return nil, err
 		}
-		for _, dn := range status.DNS {
-			if hostname == dn.Hostname {
-				ips = append(ips, hostname)
-			} else {
-				before, _, found := strings.Cut(hostname, w.dns.Search)
-				if found {
-					if before == dn.Hostname {
-						ips = append(ips, hostname)
-					}
-				}
+		answers, err := queryA(ctx, w.dns.Address, fqdn)
+		if err == nil && len(answers) > 0 {
+			return answers, nil
+		}
+		weaveErr = err
+	}
+	if mode != DNSLookupWithFallback {
+		return nil, weaveErr
+	}
+
+	if len(w.dns.Fallback) > 0 {
+		fqdn := hostname
+		if !strings.HasSuffix(fqdn, ".") {
+			fqdn += "."
+		}
+		var err error
+		for _, server := range w.dns.fallbackServers() {
+			var answers []DNSAnswer
+			if answers, err = queryA(ctx, server, fqdn); err == nil {
+				return answers, nil
 			}
 		}
+		return nil, err
 	}
-	result, err := net.LookupIP(hostname)
-	// return empty slice, not the error
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", hostname)
 	if err != nil {
-		return ips, nil
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, nil
+		}
+		return nil, err
 	}
-	for _, ip := range result {
-		ips = append(ips, ip.String())
+	answers := make([]DNSAnswer, 0, len(ips))
+	for _, ip := range ips {
+		answers = append(answers, DNSAnswer{Name: hostname, IP: ip, Source: DNSSourceSystem})
 	}
-	return ips, nil
+	return answers, nil
 }
 
 func (w *Weave) RemoveContainerDNS(containerId string, fqdn ...string) error {
@@ -357,30 +417,15 @@ func (w *Weave) RemoveContainerDNS(containerId string, fqdn ...string) error {
 	if err != nil {
 		return err
 	}
-	return w.dns.removeWeaveDNS(ip, id, f, false)
+	return w.dns.removeWeaveDNS(id, ip, f, false)
 }
 
 func (w *Weave) RemoveExternalDNS(ip, fqdn string) error {
 	return w.dns.removeWeaveDNS("", ip, fqdn, true)
 }
 
-func (w *Weave) RemovePeer(peers ...string) error {
-	if len(peers) == 0 {
-		return errors.New("should provide at least 1 peer")
-	}
-	for _, peer := range peers {
-		resp, err := callWeave(http.MethodDelete, fmt.Sprintf("/peer/%s", peer), nil)
-		if err != nil {
-			return err
-		}
-		fmt.Println(string(resp))
-	}
-
-	return nil
-}
-
 func (w *Weave) Prime() error {
-	_, err := callWeave(http.MethodGet, "/ring", nil)
+	_, err := callWeave(http.MethodGet, fmt.Sprintf("http://%s:%d/ring", w.address, w.httpPort), nil)
 	return err
 }
 
@@ -423,10 +468,20 @@ func (w *Weave) validateBridgeType() error {
 	return nil
 }
 
+// runWeaveExec runs weaveutil and returns its stdout, a non-zero exit code is
+// an error with the stderr of weaveutil.
 func (w *Weave) runWeaveExec(cmd ...string) ([]byte, error) {
 	execCmd := []string{"/usr/bin/weaveutil"}
 	execCmd = append(execCmd, cmd...)
-	return w.createWeaveExecContainer(execCmd...)
+	result, err := w.execWeaveContainer(execCmd...)
+	if err != nil {
+		return nil, err
+	}
+	if result.exitCode != 0 {
+		return nil, errors.Errorf("weaveutil %s failed with exit code %d: %s", strings.Join(cmd, " "),
+			result.exitCode, strings.TrimSpace(string(result.stderr)))
+	}
+	return result.stdout, nil
 }
 
 // runRemoteCmdWithContainer uses to run iptables, conntrack ...
@@ -434,7 +489,27 @@ func (w *Weave) runRemoteCmdWithContainer(cmd ...string) ([]byte, error) {
 	return w.createWeaveExecContainer(cmd...)
 }
 
+// runRemoteCmdWithStatus runs cmd like runRemoteCmdWithContainer, the exit
+// code and stderr of cmd are returned as well.
+func (w *Weave) runRemoteCmdWithStatus(cmd ...string) (*execResult, error) {
+	return w.execWeaveContainer(cmd...)
+}
+
+type execResult struct {
+	stdout   []byte
+	stderr   []byte
+	exitCode int64
+}
+
 func (w *Weave) createWeaveExecContainer(cmd ...string) ([]byte, error) {
+	result, err := w.execWeaveContainer(cmd...)
+	if err != nil {
+		return nil, err
+	}
+	return result.stdout, nil
+}
+
+func (w *Weave) execWeaveContainer(cmd ...string) (*execResult, error) {
 	resp, err := w.dockerCli.ContainerCreate(context.Background(), &container.Config{
 		Entrypoint: cmd,
 		Image:      fmt.Sprintf("weaveworks/weaveexec:%s", w.version),
@@ -463,29 +538,34 @@ func (w *Weave) createWeaveExecContainer(cmd ...string) ([]byte, error) {
 		return nil, err
 	}
 
+	result := &execResult{}
 	statusCh, errCh := w.dockerCli.ContainerWait(context.Background(), resp.ID, container.WaitConditionNotRunning)
 	select {
 	case err := <-errCh:
 		return nil, errors.Errorf("container start failed, err=%s", err.Error())
-	case <-statusCh:
+	case status := <-statusCh:
+		result.exitCode = status.StatusCode
 	}
 
 	// get the result of command
-	out, err := w.dockerCli.ContainerLogs(context.Background(), resp.ID, types.ContainerLogsOptions{ShowStdout: true})
+	out, err := w.dockerCli.ContainerLogs(context.Background(), resp.ID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
 	if err != nil {
 		return nil, errors.Errorf("get container log failed, err=%s", err.Error())
 	}
-	data, err := io.ReadAll(out)
-	if err != nil {
+	defer out.Close()
+	// the logs of a container without tty are multiplexed, every frame has a header
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, out); err != nil {
 		return nil, err
 	}
+	result.stdout, result.stderr = stdout.Bytes(), stderr.Bytes()
 
 	// remove the container, ignore the error
 	_ = w.dockerCli.ContainerRemove(context.Background(), resp.ID, types.ContainerRemoveOptions{
 		RemoveVolumes: true,
 		Force:         true,
 	})
-	return data, nil
+	return result, nil
 }
 
 func (w *Weave) collectCmdsAndMounts() ([]string, []mount.Mount, error) {
@@ -501,6 +581,12 @@ func (w *Weave) collectCmdsAndMounts() ([]string, []mount.Mount, error) {
 	}
 
 	resolvConfDir, resolvConfName := filepath.Split(resolvConfPath)
+	resolvConf := fmt.Sprintf("/var/run/weave/etc/%s", resolvConfName)
+	if len(w.dns.Fallback) > 0 {
+		if resolvConf, err = w.writeFallbackResolvConf(); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	containerCmds = []string{
 		"--port", strconv.Itoa(w.port),
@@ -512,7 +598,7 @@ func (w *Weave) collectCmdsAndMounts() ([]string, []mount.Mount, error) {
 		"--dns-listen-address", w.dns.Address,
 		"--http-addr", httpAddr,
 		"--status-addr", statusAddr,
-		"--resolv-conf", fmt.Sprintf("/var/run/weave/etc/%s", resolvConfName),
+		"--resolv-conf", resolvConf,
 		"--docker-bridge", "docker0",
 		"-H", "unix:///var/run/weave/weave.sock",
 		fmt.Sprintf("--log-level=%s", w.logLevel),
@@ -539,12 +625,13 @@ func (w *Weave) collectCmdsAndMounts() ([]string, []mount.Mount, error) {
 	if w.noDefaultIpAlloc {
 		containerCmds = append(containerCmds, "--no-default-ipalloc")
 	}
+	if w.awsvpc {
+		containerCmds = append(containerCmds, "--awsvpc")
+	}
 	if w.enableProxy {
 		containerCmds = append(containerCmds, "--proxy")
 	}
-	if w.dns.Disabled {
-		containerCmds = append(containerCmds, "--no-dns")
-	}
+	containerCmds = append(containerCmds, w.dns.launchArgs()...)
 	if w.withoutDNS {
 		containerCmds = append(containerCmds, "--without-dns")
 	}
@@ -554,8 +641,8 @@ func (w *Weave) collectCmdsAndMounts() ([]string, []mount.Mount, error) {
 	if w.ipAllocDefaultSubnet != "" {
 		containerCmds = append(containerCmds, "--ipalloc-default-subnet", w.ipAllocDefaultSubnet)
 	}
-	if w.ipAllocInit != "" {
-		containerCmds = append(containerCmds, "--ipalloc-init", w.ipAllocInit)
+	if len(w.ipAllocInits) > 0 {
+		containerCmds = append(containerCmds, "--ipalloc-init", w.ipAllocInits[0].String())
 	}
 	if w.noMultiRouter {
 		containerCmds = append(containerCmds, "--no-multicast-route")
@@ -610,18 +697,33 @@ func (w *Weave) collectCmdsAndMounts() ([]string, []mount.Mount, error) {
 	return containerCmds, containerMounts, nil
 }
 
+// writeFallbackResolvConf writes the fallback resolvers of weaveDNS to a
+// resolv.conf in /var/run/weave, which is mounted into the router container.
+func (w *Weave) writeFallbackResolvConf() (string, error) {
+	if err := w.dns.validateFallback(); err != nil {
+		return "", err
+	}
+	var conf strings.Builder
+	for _, server := range w.dns.Fallback {
+		host, _, err := net.SplitHostPort(server)
+		if err != nil {
+			host = server
+		}
+		fmt.Fprintf(&conf, "nameserver %s\n", host)
+	}
+	if _, err := w.runRemoteCmdWithContainer("sh", "-c",
+		fmt.Sprintf("mkdir -p /host/var/run/weave && printf '%s' > /host%s", conf.String(), fallbackResolvConf)); err != nil {
+		return "", err
+	}
+	return fallbackResolvConf, nil
+}
+
 func (w *Weave) getRemoteResolvConfPath() (string, error) {
 	result, err := w.runRemoteCmdWithContainer("readlink", "-f", "/host/etc/resolv.conf")
 	if err != nil {
 		return "", err
 	}
-	i := 0
-	for ; i < len(result); i++ {
-		if string(result[i]) == "/" {
-			break
-		}
-	}
-	return string(result[i:]), nil
+	return strings.TrimSpace(string(result)), nil
 }
 
 func (w *Weave) Close() error {